@@ -6,30 +6,105 @@
 // that respect to affinity constraints.
 package rsdmatch
 
+import "context"
+
 type Matcher interface {
-	// Match will reduce suppliers.CapRest and buyers.DemandRest.
+	// Match will reduce suppliers.CapRest and buyers.DemandRest, see Solve for the
+	// non-mutating alternative.
 	Match(suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool)
 }
 
+// ContextMatcher is a Matcher that respects the cancellation and deadline of a context.
+type ContextMatcher interface {
+	Matcher
+
+	// MatchContext is like Match, but when ctx is done before the matching completes,
+	// it stops and returns the matches made so far together with ctx.Err(). The partial
+	// matches are consistent with the reduced CapRest and DemandRest.
+	MatchContext(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool, err error)
+}
+
+// MatchContext calls m.MatchContext when m is a ContextMatcher, otherwise it checks
+// ctx only once before calling m.Match.
+func MatchContext(ctx context.Context, m Matcher, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool, err error) {
+	if cm, ok := m.(ContextMatcher); ok {
+		return cm.MatchContext(ctx, suppliers, buyers, affinities)
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	matches, perfect = m.Match(suppliers, buyers, affinities)
+	return
+}
+
 type Supplier struct {
 	ID       string
 	Cap      int64
 	CapRest  int64
 	Priority int64
 	Info     interface{}
+
+	// The capacities of the extra dimensions (e.g. storage, connections), a negative
+	// or missing one is unlimited. See Buyer.ExtraDemand.
+	ExtraCap     []int64
+	ExtraCapRest []int64
+
+	// The max number of buyers the supplier can serve, unlimited when <= 0. BuyersRest
+	// is reduced when the supplier is sold to a new buyer, like CapRest.
+	MaxBuyers  int
+	BuyersRest int
+
+	// The failure domain (e.g. IDC, rack) of the supplier, see Buyer.MaxDomainShare.
+	// Empty means no domain, such a supplier is not limited by the domain constraints.
+	Domain string
 }
 
 type Buyer struct {
 	ID         string
 	Demand     int64
 	DemandRest int64
+	Priority   int64 // higher is served first, see FairMatcher.
 	Info       interface{}
+
+	// The max ratio of Demand that can be bought from a single supplier, it limits
+	// every supplier like a BuyLimit, but no less than 1. Unlimited when <= 0 or >= 1.
+	MaxShare float32
+
+	// The max ratio of Demand that can be bought from a single Supplier.Domain, no
+	// less than 1, unlimited when <= 0 or >= 1. And the min number of domains, which
+	// caps every domain to ceil(Demand / MinDomains), so the buyer can not be
+	// satisfied by fewer domains. Unlimited when <= 1.
+	MaxDomainShare float32
+	MinDomains     int
+
+	// The demands of the extra dimensions, they are consumed in proportion to the
+	// amount bought, i.e. buying amount consumes ExtraDemand[k] * amount / Demand
+	// (rounded up) of Supplier.ExtraCapRest[k]. So the amount bought from a supplier
+	// is also limited by its extra capacities.
+	ExtraDemand []int64
 }
 
 type AffinityTable interface {
 	Find(supplier *Supplier, buyer *Buyer) Affinity
 }
 
+// CandidateTable is an optional interface implemented by an AffinityTable that can
+// list the viable suppliers of a buyer, matchers use it when provided instead of
+// calling Find on every (supplier, buyer) pair.
+type CandidateTable interface {
+	AffinityTable
+
+	// Candidates returns the suppliers that may sell to the buyer, in ascending
+	// order of index. The suppliers not returned are treated as having a zero
+	// BuyLimit. The suppliers slice is the same for all the calls of a Match.
+	Candidates(suppliers []Supplier, buyer *Buyer) []Candidate
+}
+
+type Candidate struct {
+	Supplier int // index of suppliers
+	Affinity Affinity
+}
+
 type Affinity struct {
 	Price float32
 	Limit BuyLimit // can be nil
@@ -5,15 +5,31 @@
 // Package bandwidth uses rdsmatch to match bandwidth.
 package bandwidth
 
-import "github.com/someonegg/rsdmatch/distscore"
+import (
+	"github.com/someonegg/rsdmatch"
+	"github.com/someonegg/rsdmatch/distscore"
+)
 
 type Node struct {
 	Node      string  `json:"node"`
 	ISP       string  `json:"isp"`
 	Province  string  `json:"province"`
+	City      string  `json:"city"`     // optional, see distscore.Location.City.
+	IP        string  `json:"ip"`       // resolves the empty location fields, see Matcher.Resolver.
 	Bandwidth float64 `json:"bw"`       // Gbps,
 	Priority  float64 `json:"priority"` // Keep three decimal places.
 	LocalOnly bool    `json:"local_only"`
+
+	// The extra capacities, unlimited when <= 0.
+	Storage float64 `json:"storage"` // TB, keep three decimal places.
+	Conns   int64   `json:"conns"`   // connections
+
+	// The max number of views the node can serve, unlimited when <= 0. The views
+	// merged by Matcher.AutoMergeView count as one.
+	MaxViews int `json:"max_views"`
+
+	// The failure domain, e.g. the IDC, rack or uplink, see ViewOption.MaxDomainShare.
+	Domain string `json:"domain"`
 }
 
 type NodeSet struct {
@@ -24,7 +40,16 @@ type View struct {
 	View      string  `json:"view"`
 	ISP       string  `json:"isp"`
 	Province  string  `json:"province"`
-	Bandwidth float64 `json:"bw"` // Gbps
+	City      string  `json:"city"`      // optional, see distscore.Location.City.
+	IP        string  `json:"ip"`        // resolves the empty location fields, see Matcher.Resolver.
+	Bandwidth float64 `json:"bw"`        // Gbps
+	Priority  int64   `json:"priority"`  // higher is served first when nodes are short.
+	MaxShare  float32 `json:"max_share"` // overrides ViewOption.MaxNodeShare when > 0.0.
+
+	// The extra demands, they are spread over the nodes in proportion to the bandwidth,
+	// see rsdmatch.Buyer.ExtraDemand.
+	Storage float64 `json:"storage"` // TB, keep three decimal places.
+	Conns   int64   `json:"conns"`   // connections
 }
 
 type ViewOption struct {
@@ -36,6 +61,48 @@ type ViewOption struct {
 
 	ExclusiveMode bool `json:"exclusive"` // a node will only be assigned to one view.
 
+	// Specify the max ratio of the bandwidth of a view from a single node [0.0-1.0],
+	// 0.0 means unlimited. See rsdmatch.Buyer.MaxShare.
+	MaxNodeShare float32 `json:"max_share"`
+
+	// Specify the max ratio of the bandwidth of a view from a single Node.Domain
+	// [0.0-1.0], 0.0 means unlimited. And the min number of domains of a view, each
+	// domain gets at most 1/MinDomains of the bandwidth, 0 or 1 means unlimited. See
+	// rsdmatch.Buyer.MaxDomainShare.
+	MaxDomainShare float32 `json:"max_domain_share"`
+	MinDomains     int     `json:"min_domains"`
+
+	// The minimum bandwidth (Gbps) of a node in the ring of a view, and the granularity
+	// of the bandwidth, see rsdmatch.GreedyOption. Not used by Matcher.Optimal.
+	MinBandwidth  float64 `json:"min_bw"`
+	BandwidthStep float64 `json:"bw_step"`
+
+	// When set, the nodes with the same score tier and priority are shuffled by the seed
+	// for each view, to spread the load evenly over them, see rsdmatch.GreedyOption.
+	// Not used by Matcher.Optimal.
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Divide the bandwidth of a view over the nodes of a score tier in exact proportion
+	// to the priorities, see rsdmatch.GreedyOption.LargestRemainder. Not used by
+	// Matcher.Optimal.
+	LargestRemainder bool `json:"largest_remainder"`
+
+	// Specify how the shortage of the views with the same priority is spread when nodes
+	// are short, rsdmatch.MaxMinFair or rsdmatch.ProportionalFair, see
+	// rsdmatch.FairMatcher. Empty means no fairness.
+	Fairness string `json:"fairness"`
+
+	// Specify the ratio of the bandwidth a view must keep after losing any one node
+	// [0.0-1.0], or any one Node.Domain when SurviveDomain, the nodes are over-provisioned
+	// for it. 0.0 means disabled. See rsdmatch.SurvivableMatcher.
+	Survivability float32 `json:"survive"`
+	SurviveDomain bool    `json:"survive_domain"`
+
+	// When ViewSet.Previous is set, the score of a node already in the ring of a view is
+	// reduced by Stickiness, to keep the previous assignments, see
+	// rsdmatch.StickyAffinityTable.
+	Stickiness float32 `json:"sticky"`
+
 	NodeFilter func(*Node, *View) bool `json:"-"` // can be nil
 }
 
@@ -50,6 +117,10 @@ var DefaultViewOption = &ViewOption{
 type ViewSet struct {
 	Elems  []*View     `json:"elems"`
 	Option *ViewOption `json:"option"` // DefaultViewOption when nil.
+
+	// The rings matched previously, used as a hint when ViewOption.Stickiness > 0.
+	// The weights are in Mbps too.
+	Previous *RingSet `json:"previous,omitempty"`
 }
 
 type Ring struct {
@@ -86,6 +157,22 @@ type Matcher struct {
 	// https://pkg.go.dev/github.com/someonegg/rsdmatch/distscore/china#DistScore
 	Scorer distscore.DistScorer
 
+	// When Resolver is set, the nodes and views with an empty ISP or Province are located
+	// by their IP, the empty fields are filled from the resolved location (the City only
+	// in the same province). The nodes and views passed in are not modified.
+	// See https://pkg.go.dev/github.com/someonegg/rsdmatch/distscore/ipdb
+	Resolver distscore.LocationResolver
+
+	// When set, use the optimal rsdmatch.MinCostMatcher instead of rsdmatch.GreedyMatcher,
+	// ViewOption.ScoreSensitivity and ViewOption.EnoughNodeCount are ignored then. In
+	// ViewOption.ExclusiveMode, use rsdmatch.NewExclusiveMatcher instead, which is not
+	// optimal but never worse than the rsdmatch.GreedyMatcher of the view option.
+	Optimal bool `json:"opt"`
+
+	// Receives the matching events, see rsdmatch.Tracer. When Tracer is nil, use the
+	// tracer carried by the context, or trace as text to stdout when Verbose.
+	Tracer rsdmatch.Tracer `json:"-"`
+
 	Verbose bool `json:"vv"`
 }
 
@@ -97,6 +184,28 @@ type Summary struct {
 	BandwidthNeeds   float64 `json:"bw_needs"`
 	BandwidthRemains float64 `json:"bw_remains"`
 
+	// The count of (view, node) assignments not in ViewSet.Previous, and their
+	// bandwidth (Gbps), only counted for the ViewSets with Previous.
+	Moved          int     `json:"moved"`
+	MovedBandwidth float64 `json:"moved_bw"`
+
+	// The broken invariants of the matching result, see rsdmatch.Verify. The rings
+	// should not be published when it is not empty.
+	Violations rsdmatch.Violations `json:"violations,omitempty"`
+
+	// The views (merged by location with Matcher.AutoMergeView) that can not survive the
+	// loss of a node or domain, only checked for the ViewSets with
+	// ViewOption.Survivability, see rsdmatch.CheckSurvivable. The amounts are Mbps.
+	Unsurvivable []rsdmatch.Unsurvivable `json:"unsurvivable,omitempty"`
+
+	// The quality of the matching of each ViewSet, see rsdmatch.ComputeMetrics. The
+	// amounts are Mbps, the prices are the distance scores, and the bands are near
+	// (score < RemoteAccessScore), remote (score < RejectScore) and rejected.
+	Metrics []rsdmatch.Metrics `json:"metrics"`
+
+	// Matching was stopped by the context, see Matcher.MatchContext.
+	Incomplete bool `json:"incomplete"`
+
 	// when AutoScale
 	Scales map[string]float64 `json:"scales"`
 }
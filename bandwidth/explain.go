@@ -0,0 +1,127 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bandwidth
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/someonegg/rsdmatch"
+)
+
+// Explanation tells why a view got (or did not get) a node, see Matcher.Explain.
+type Explanation struct {
+	View string `json:"view"`
+	Node string `json:"node"`
+
+	Score    float32 `json:"score"` // the price of the pair
+	Tier     int     `json:"tier"`  // the price tier by ViewOption.ScoreSensitivity
+	Local    bool    `json:"local"`
+	Decision string  `json:"decision"` // the decision of the affinity, e.g. DecisionRemote
+	Limit    int64   `json:"limit"`    // Mbps, see rsdmatch.MaxBuy, -1 when unlimited
+
+	// The matching of the buyer of the view, whose ID is the merged one when
+	// AutoMergeView, the amounts are in units of 100Mbps.
+	rsdmatch.Explanation
+}
+
+func (x Explanation) String() string {
+	limit := "unlimited"
+	if x.Limit >= 0 {
+		limit = fmt.Sprint(x.Limit, "Mbps")
+	}
+	return fmt.Sprintf("%s <- %s: score %v (tier %d), local %v, %s, limit %s\n%s",
+		x.View, x.Node, x.Score, x.Tier, x.Local, x.Decision, limit, x.Explanation)
+}
+
+// Explain matches like Match, and explains why the view got (or did not get) the node.
+// The matching is traced by a rsdmatch.Recorder, Matcher.Tracer and Verbose are not used.
+// The view name must be unique in viewss.
+func (m *Matcher) Explain(nodes NodeSet, viewss []ViewSet, view, node string) (Explanation, error) {
+	x := Explanation{View: view, Node: node}
+	nodes, viewss = m.resolve(nodes, viewss)
+
+	var n *Node
+	for _, elem := range nodes.Elems {
+		if elem.Node == node {
+			n = elem
+			break
+		}
+	}
+	if n == nil {
+		return x, fmt.Errorf("node %s not found", node)
+	}
+
+	var (
+		v      *View
+		option *ViewOption
+		set    int
+	)
+	for k, views := range viewss {
+		for _, elem := range views.Elems {
+			if elem.View != view {
+				continue
+			}
+			if v != nil {
+				// The events of the views can not be told apart.
+				return x, fmt.Errorf("view %s is duplicated", view)
+			}
+			v, option, set = elem, views.Option, k
+		}
+	}
+	if v == nil {
+		return x, fmt.Errorf("view %s not found", view)
+	}
+	if option == nil {
+		option = DefaultViewOption
+	}
+
+	rec := &rsdmatch.Recorder{}
+	traced := *m
+	traced.Tracer = rec
+	traced.Verbose = false
+	_, summ := traced.Match(nodes, viewss)
+
+	unifier, scorer := traced.Unifier, traced.Scorer // set by Match
+
+	table := newAffinityTable(option, unifier, scorer).(*affinityTable)
+	score, local := scorer.DistScore(
+		unifier.Unify(v.location(), false),
+		unifier.Unify(n.location(), true))
+	a, decision := table.affinity(n, v, score, local)
+
+	x.Score, x.Local, x.Decision = score, local, decision
+	x.Tier = int(score / option.ScoreSensitivity)
+
+	buyerID := view
+	if m.AutoMergeView {
+		buyerID = mergedBuyerID(unifier, v)
+	}
+
+	// The limit of the supplier and buyer matched, with the scaled (and merged) demand
+	// and the MaxShare.
+	suppliers, _, _ := genSuppliers(unifier, nodes)
+	buyerss, _, _ := genBuyerss(unifier, viewss, summ.Scales)
+	buyers := buyerss[set].Elems
+	if m.AutoMergeView {
+		buyers, _ = mergeBuyers(unifier, buyers)
+	}
+	x.Limit = -1
+	for i := range suppliers.Elems {
+		if suppliers.Elems[i].ID != node {
+			continue
+		}
+		for j := range buyers {
+			if buyers[j].ID != buyerID {
+				continue
+			}
+			if limit := rsdmatch.MaxBuy(a, &suppliers.Elems[i], &buyers[j]); limit != math.MaxInt64 {
+				x.Limit = limit * bwUnit
+			}
+		}
+	}
+	x.Explanation = rsdmatch.Explain(rec.Events, buyerID, node)
+	return x, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bandwidth
+
+import (
+	"strings"
+	"testing"
+)
+
+// 1. 测试匹配解释
+func TestMatcher_Explain(t *testing.T) {
+	local := makeNode("node1", "移动", "广东", 1.0, 1.0)
+	remote := makeNode("node2", "移动", "广西", 1.0, 1.0)
+	only := makeNode("node3", "移动", "湖南", 1.0, 1.0)
+	only.LocalOnly = true
+	nodes := NodeSet{Elems: []*Node{local, remote, only}}
+
+	viewss := []ViewSet{
+		{
+			Elems: []*View{
+				makeView("广东-移动", "移动", "广东", 0.5),
+			},
+			Option: &ViewOption{
+				EnoughNodeCount:   1,
+				RemoteAccessScore: 50.0,
+				RejectScore:       80.0,
+				RemoteAccessLimit: 0.5,
+				ScoreSensitivity:  10.0,
+			},
+		},
+	}
+	matcher := &Matcher{}
+
+	t.Run("Allocated", func(t *testing.T) {
+		x, err := matcher.Explain(nodes, viewss, "广东-移动", "node1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !x.Local || x.Decision != DecisionNear || x.Limit != -1 {
+			t.Errorf("Unexpected %+v", x)
+		}
+		if x.Allocated != 5 || len(x.Considered) != 1 {
+			t.Errorf("Expected 5 units allocated, got %v", x.Explanation)
+		}
+	})
+
+	t.Run("NotConsidered", func(t *testing.T) {
+		x, err := matcher.Explain(nodes, viewss, "广东-移动", "node2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.Local || x.Allocated != 0 || len(x.Considered) != 0 {
+			t.Errorf("Unexpected %v", x)
+		}
+		if x.Stopped == nil {
+			t.Fatalf("Expected the buyer stopped, got %v", x)
+		}
+		if !strings.Contains(x.String(), "buyer stopped: "+x.Stopped.Reason) {
+			t.Errorf("Unexpected %q", x.String())
+		}
+	})
+
+	t.Run("LocalOnly", func(t *testing.T) {
+		x, err := matcher.Explain(nodes, viewss, "广东-移动", "node3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.Decision != DecisionLocalOnly || x.Limit != 0 {
+			t.Errorf("Unexpected %v", x)
+		}
+	})
+
+	t.Run("MaxShare", func(t *testing.T) {
+		shared := makeView("广东-移动", "移动", "广东", 0.5)
+		option := *viewss[0].Option
+		option.MaxNodeShare = 0.6
+		viewss := []ViewSet{{Elems: []*View{shared}, Option: &option}}
+
+		// ViewOption.MaxNodeShare
+		x, err := matcher.Explain(nodes, viewss, "广东-移动", "node1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.Limit != 300 || x.Allocated != 3 {
+			t.Errorf("Expected limit 300Mbps and 3 units allocated, got %v", x)
+		}
+
+		// View.MaxShare 优先
+		shared.MaxShare = 0.4
+		x, err = matcher.Explain(nodes, viewss, "广东-移动", "node1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.Limit != 200 || x.Allocated != 2 {
+			t.Errorf("Expected limit 200Mbps and 2 units allocated, got %v", x)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		viewss := []ViewSet{viewss[0], viewss[0]}
+		if _, err := matcher.Explain(nodes, viewss, "广东-移动", "node1"); err == nil {
+			t.Error("Expected error for duplicated view")
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if _, err := matcher.Explain(nodes, viewss, "广东-移动", "node9"); err == nil {
+			t.Error("Expected error for unknown node")
+		}
+		if _, err := matcher.Explain(nodes, viewss, "广西-移动", "node1"); err == nil {
+			t.Error("Expected error for unknown view")
+		}
+	})
+}
@@ -5,8 +5,9 @@
 package bandwidth
 
 import (
-	"fmt"
+	"context"
 	"math"
+	"net"
 	"sort"
 
 	"github.com/someonegg/rsdmatch"
@@ -16,15 +17,33 @@ import (
 
 const bwUnit = 100 // Mbps
 
-func (o *ViewOption) Fix() {
+// Fix resets the invalid fields to default, and returns the names of them.
+func (o *ViewOption) Fix() (fixed []string) {
 	if ral := o.RemoteAccessLimit; !(ral >= 0.0 && ral <= 1.0) {
 		o.RemoteAccessLimit = DefaultViewOption.RemoteAccessLimit
-		fmt.Println("RemoteAccessLimit fixed")
+		fixed = append(fixed, "RemoteAccessLimit")
+	}
+	if ms := o.MaxNodeShare; !(ms >= 0.0 && ms <= 1.0) {
+		o.MaxNodeShare = DefaultViewOption.MaxNodeShare
+		fixed = append(fixed, "MaxNodeShare")
+	}
+	if mds := o.MaxDomainShare; !(mds >= 0.0 && mds <= 1.0) {
+		o.MaxDomainShare = DefaultViewOption.MaxDomainShare
+		fixed = append(fixed, "MaxDomainShare")
+	}
+	if sv := o.Survivability; !(sv >= 0.0 && sv <= 1.0) {
+		o.Survivability = DefaultViewOption.Survivability
+		fixed = append(fixed, "Survivability")
 	}
 	if o.ScoreSensitivity <= 0.0 {
 		o.ScoreSensitivity = DefaultViewOption.ScoreSensitivity
-		fmt.Println("ScoreSensitivity fixed")
+		fixed = append(fixed, "ScoreSensitivity")
 	}
+	if f := o.Fairness; f != "" && f != rsdmatch.MaxMinFair && f != rsdmatch.ProportionalFair {
+		o.Fairness = DefaultViewOption.Fairness
+		fixed = append(fixed, "Fairness")
+	}
+	return
 }
 
 type affinityTable struct {
@@ -35,6 +54,11 @@ type affinityTable struct {
 
 	unifier ds.LocationUnifier
 	scorer  ds.DistScorer
+
+	// suppliers indexed by location, see Candidates.
+	indexed   *rsdmatch.Supplier
+	locations []ds.Location
+	located   map[ds.Location][]int
 }
 
 func newAffinityTable(o *ViewOption, unifier ds.LocationUnifier, scorer ds.DistScorer) rsdmatch.AffinityTable {
@@ -53,40 +77,102 @@ func (t *affinityTable) Find(supplier *rsdmatch.Supplier, buyer *rsdmatch.Buyer)
 	view := buyer.Info.(*View)
 
 	score, local := t.scorer.DistScore(
-		t.unifier.Unify(ds.Location{ISP: view.ISP, Province: view.Province}, false),
-		t.unifier.Unify(ds.Location{ISP: node.ISP, Province: node.Province}, true))
+		t.unifier.Unify(view.location(), false),
+		t.unifier.Unify(node.location(), true))
+	a, _ := t.affinity(node, view, score, local)
+	return a
+}
+
+// The decisions of affinityTable.affinity.
+const (
+	DecisionFiltered  = "filtered"   // rejected by ViewOption.NodeFilter
+	DecisionLocalOnly = "local_only" // the node is Node.LocalOnly, and the view is not local
+	DecisionNear      = "near"       // score < RemoteAccessScore, no limit
+	DecisionRemote    = "remote"     // score < RejectScore, limited by RemoteAccessLimit
+	DecisionRejected  = "rejected"   // score >= RejectScore
+)
+
+func (t *affinityTable) affinity(node *Node, view *View, score float32, local bool) (rsdmatch.Affinity, string) {
 	// filter
 	if t.filter != nil && !t.filter(node, view) {
 		return rsdmatch.Affinity{
 			Price: score,
 			Limit: nodePercentLimit(0.0),
-		}
+		}, DecisionFiltered
 	}
 	// local only
 	if node.LocalOnly && !local {
 		return rsdmatch.Affinity{
 			Price: score,
 			Limit: nodePercentLimit(0.0),
-		}
+		}, DecisionLocalOnly
 	}
 	// near
 	if score < t.ras {
 		return rsdmatch.Affinity{
 			Price: score,
 			Limit: nil,
-		}
+		}, DecisionNear
 	}
 	// remote
 	if score < t.rjs {
 		return rsdmatch.Affinity{
 			Price: score,
 			Limit: nodePercentLimit(t.ral),
-		}
+		}, DecisionRemote
 	}
 	// reject
 	return rsdmatch.Affinity{
 		Price: score,
 		Limit: nodePercentLimit(0.0),
+	}, DecisionRejected
+}
+
+// Candidates scores the view once per node location instead of once per node,
+// and skips the rejected locations entirely.
+func (t *affinityTable) Candidates(suppliers []rsdmatch.Supplier, buyer *rsdmatch.Buyer) []rsdmatch.Candidate {
+	if len(suppliers) == 0 {
+		return nil
+	}
+	if t.indexed != &suppliers[0] {
+		t.index(suppliers)
+	}
+
+	view := buyer.Info.(*View)
+	client := t.unifier.Unify(view.location(), false)
+
+	var candidates []rsdmatch.Candidate
+	for _, location := range t.locations {
+		score, local := t.scorer.DistScore(client, location)
+		if score >= t.rjs {
+			continue
+		}
+		for _, i := range t.located[location] {
+			a, _ := t.affinity(suppliers[i].Info.(*Node), view, score, local)
+			if a.Limit != nil && a.Limit.Calculate(suppliers[i].Cap, buyer.Demand) <= 0 {
+				continue
+			}
+			candidates = append(candidates, rsdmatch.Candidate{Supplier: i, Affinity: a})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Supplier < candidates[j].Supplier
+	})
+	return candidates
+}
+
+func (t *affinityTable) index(suppliers []rsdmatch.Supplier) {
+	t.indexed = &suppliers[0]
+	t.locations = nil
+	t.located = make(map[ds.Location][]int)
+	for i := range suppliers {
+		node := suppliers[i].Info.(*Node)
+		location := t.unifier.Unify(node.location(), true)
+		if _, ok := t.located[location]; !ok {
+			t.locations = append(t.locations, location)
+		}
+		t.located[location] = append(t.located[location], i)
 	}
 }
 
@@ -97,6 +183,14 @@ func (p nodePercentLimit) Calculate(supplierCap, buyerDemand int64) int64 {
 }
 
 func (m *Matcher) Match(nodes NodeSet, viewss []ViewSet) (ringss []RingSet, summ Summary) {
+	ringss, summ, _ = m.MatchContext(context.Background(), nodes, viewss)
+	return
+}
+
+// MatchContext is like Match, but stops matching when ctx is done. The rings matched so
+// far are still returned, summ.Incomplete is set and err is ctx.Err() then.
+func (m *Matcher) MatchContext(ctx context.Context, nodes NodeSet, viewss []ViewSet) (ringss []RingSet, summ Summary, err error) {
+	nodes, viewss = m.resolve(nodes, viewss)
 	if m.Unifier == nil {
 		m.Unifier = china.NewLocationUnifier(m.ProxyMunici)
 	}
@@ -104,6 +198,28 @@ func (m *Matcher) Match(nodes NodeSet, viewss []ViewSet) (ringss []RingSet, summ
 		m.Scorer = china.NewDistScorer()
 	}
 
+	tracer := m.tracer(ctx)
+	if tracer != nil {
+		ctx = rsdmatch.WithTracer(ctx, tracer)
+
+		for _, node := range nodes.Elems {
+			if incomplete(node) {
+				tracer.Trace(NodeIncomplete{node.Node})
+			}
+		}
+	}
+	for _, views := range viewss {
+		option := views.Option
+		if option == nil {
+			option = DefaultViewOption
+		}
+		for _, field := range option.Fix() {
+			if tracer != nil {
+				tracer.Trace(OptionFixed{field})
+			}
+		}
+	}
+
 	suppliers, supplierCount, ispHasBW := genSuppliers(m.Unifier, nodes)
 	buyerss, buyerCount, ispNeedsBW := genBuyerss(m.Unifier, viewss, summ.Scales)
 	if m.AutoScale {
@@ -137,31 +253,50 @@ func (m *Matcher) Match(nodes NodeSet, viewss []ViewSet) (ringss []RingSet, summ
 	summ.ViewsCount = buyerCount
 	summ.NodesBandwidth = float64(bwHas) / float64(1000/bwUnit)
 	summ.ViewsBandwidth = float64(bwNeeds) / float64(1000/bwUnit)
-	if m.Verbose {
-		fmt.Printf("nodes: %v, views: %v, needs: %v, has: %v\n", supplierCount, buyerCount, bwNeeds*bwUnit, bwHas*bwUnit)
-		fmt.Println("")
+	if tracer != nil {
+		tracer.Trace(MatchStarted{supplierCount, buyerCount, bwNeeds * bwUnit, bwHas * bwUnit})
 	}
 
-	for _, buyers := range buyerss {
+	for index, buyers := range buyerss {
 		var buyerViews map[string][]string
 		if m.AutoMergeView {
 			buyers.Elems, buyerViews = mergeBuyers(m.Unifier, buyers.Elems)
-			if m.Verbose {
-				fmt.Println("merged views:")
-				for _, views := range buyerViews {
-					if len(views) > 1 {
-						fmt.Println("  ", views)
+			if tracer != nil {
+				var groups [][]string
+				for _, buyer := range buyers.Elems {
+					if views := buyerViews[buyer.ID]; len(views) > 1 {
+						groups = append(groups, views)
 					}
 				}
-				fmt.Println("")
+				tracer.Trace(ViewsMerged{groups})
 			}
 		}
 
-		matches, _ := rsdmatch.GreedyMatcher(buyers.Option.ScoreSensitivity, buyers.Option.ScoreSensitivity,
-			buyers.Option.EnoughNodeCount, buyers.Option.ExclusiveMode, m.Verbose).Match(
-			suppliers.Elems, buyers.Elems, newAffinityTable(buyers.Option, m.Unifier, m.Scorer))
-		if m.Verbose {
-			fmt.Println()
+		table := newAffinityTable(buyers.Option, m.Unifier, m.Scorer)
+		affinities := table
+		if buyers.Previous != nil && buyers.Option.Stickiness > 0 {
+			affinities = rsdmatch.StickyAffinityTable(table,
+				previousMatches(buyers.Previous, buyerViews), buyers.Option.Stickiness)
+		}
+
+		matches, _, merr := rsdmatch.MatchContext(ctx, m.newMatcher(buyers.Option),
+			suppliers.Elems, buyers.Elems, affinities)
+		if merr != nil {
+			summ.Incomplete = true
+			err = merr
+		}
+		summ.Violations = append(summ.Violations, rsdmatch.Verify(suppliers.Elems, buyers.Elems,
+			table, matches, buyers.Option.ExclusiveMode)...)
+		summ.Metrics = append(summ.Metrics, metrics(suppliers.Elems, buyers.Elems, table, matches, buyers.Option))
+		if buyers.Option.Survivability > 0.0 {
+			for _, u := range rsdmatch.CheckSurvivable(suppliers.Elems, buyers.Elems, matches, buyers.Option.survivableOption()) {
+				u.Target *= bwUnit
+				u.Kept *= bwUnit
+				summ.Unsurvivable = append(summ.Unsurvivable, u)
+			}
+		}
+		if tracer != nil {
+			tracer.Trace(ViewSetMatched{index})
 		}
 
 		buyerDemand := make(map[string]int64)
@@ -175,19 +310,25 @@ func (m *Matcher) Match(nodes NodeSet, viewss []ViewSet) (ringss []RingSet, summ
 				buyerDemand[elem.ID] += elem.Demand * bwUnit
 				if rest := elem.DemandRest; rest > 0 {
 					rests += rest
-					if m.Verbose {
-						fmt.Println(elem.ID, "demand:", elem.Demand*bwUnit, "demand_rest:", rest*bwUnit)
+					if tracer != nil {
+						tracer.Trace(BuyerShortfall{elem.ID, elem.Demand * bwUnit, rest * bwUnit})
 					}
 				}
 			}
-			if m.Verbose && rests > 0 {
-				fmt.Println("total needs", rests*bwUnit)
-				fmt.Println("")
+			if tracer != nil && rests > 0 {
+				tracer.Trace(ShortfallTotal{rests * bwUnit})
 			}
 			summ.BandwidthNeeds += float64(rests) / float64(1000/bwUnit)
 		}
 
-		ringss = append(ringss, genRings(matches, buyerViews, buyerDemand))
+		rings := genRings(matches, buyerViews, buyerDemand)
+		if buyers.Previous != nil {
+			moved, amount := rsdmatch.Churn(ringMatches(buyers.Previous), ringMatches(&rings))
+			summ.Moved += moved
+			summ.MovedBandwidth += float64(amount) / 1000
+		}
+
+		ringss = append(ringss, rings)
 	}
 
 	{
@@ -200,16 +341,15 @@ func (m *Matcher) Match(nodes NodeSet, viewss []ViewSet) (ringss []RingSet, summ
 			if rest := elem.CapRest; rest > 0 {
 				rests += rest
 				node := elem.Info.(*Node)
-				if m.Verbose {
-					fmt.Println(node.ISP, node.Province, elem.ID, "cap:", elem.Cap*bwUnit, "cap_rest:", rest*bwUnit)
+				if tracer != nil {
+					tracer.Trace(NodeRemains{node.ISP, node.Province, elem.ID, elem.Cap * bwUnit, rest * bwUnit})
 				}
 			} else {
 				break
 			}
 		}
-		if m.Verbose && rests > 0 {
-			fmt.Println("total remains", rests*bwUnit)
-			fmt.Println("")
+		if tracer != nil && rests > 0 {
+			tracer.Trace(RemainsTotal{rests * bwUnit})
 		}
 		summ.BandwidthRemains = float64(rests) / float64(1000/bwUnit)
 	}
@@ -217,6 +357,57 @@ func (m *Matcher) Match(nodes NodeSet, viewss []ViewSet) (ringss []RingSet, summ
 	return
 }
 
+func (m *Matcher) newMatcher(o *ViewOption) rsdmatch.Matcher {
+	gopt := rsdmatch.GreedyOption{
+		Sensitivity: o.ScoreSensitivity,
+		Bottom:      o.ScoreSensitivity,
+		Enough:      o.EnoughNodeCount,
+		Exclusive:   o.ExclusiveMode,
+		Verbose:     m.Verbose,
+		MinAmount:   int64(math.Ceil(o.MinBandwidth * float64(1000/bwUnit))),
+		Step:        int64(math.Ceil(o.BandwidthStep * float64(1000/bwUnit))),
+
+		LargestRemainder: o.LargestRemainder,
+	}
+	if o.Seed != nil {
+		gopt.Shuffle, gopt.Seed = true, *o.Seed
+	}
+
+	var matcher rsdmatch.Matcher
+	switch {
+	case m.Optimal && o.ExclusiveMode:
+		// Never worse than the greedy matching of the view option.
+		matcher = rsdmatch.NewExclusiveMatcher(rsdmatch.ExclusiveOption{Greedy: gopt, Verbose: m.Verbose})
+	case m.Optimal:
+		matcher = rsdmatch.MinCostMatcher(m.Verbose)
+	default:
+		matcher = rsdmatch.NewGreedyMatcher(gopt)
+	}
+	matcher = rsdmatch.FairMatcher(matcher, o.Fairness)
+	if o.Survivability > 0.0 {
+		matcher = rsdmatch.SurvivableMatcher(matcher, o.survivableOption())
+	}
+	return matcher
+}
+
+// metrics computes the metrics of the matches in Mbps.
+func metrics(suppliers []rsdmatch.Supplier, buyers []rsdmatch.Buyer, table rsdmatch.AffinityTable,
+	matches rsdmatch.Matches, o *ViewOption) rsdmatch.Metrics {
+
+	x := rsdmatch.ComputeMetrics(suppliers, buyers, table, matches, o.RemoteAccessScore, o.RejectScore)
+	x.Demand *= bwUnit
+	x.Matched *= bwUnit
+	x.Cost *= bwUnit
+	for k := range x.Bands {
+		x.Bands[k].Amount *= bwUnit
+	}
+	return x
+}
+
+func (o *ViewOption) survivableOption() rsdmatch.SurvivableOption {
+	return rsdmatch.SurvivableOption{Fraction: o.Survivability, Domain: o.SurviveDomain}
+}
+
 type supplierSet struct {
 	Elems []rsdmatch.Supplier
 }
@@ -227,17 +418,21 @@ func genSuppliers(unifier ds.LocationUnifier, nodes NodeSet) (supplierSet, int,
 	suppliers := make([]rsdmatch.Supplier, len(nodes.Elems))
 
 	for i, node := range nodes.Elems {
-		location := unifier.Unify(ds.Location{ISP: node.ISP, Province: node.Province}, true)
+		location := unifier.Unify(node.location(), true)
 		suppliers[i].ID = node.Node
-		suppliers[i].Cap = int64(math.Floor(node.Bandwidth * float64(1000/bwUnit)))
-		if node.ISP == "" || node.Province == "" {
+		suppliers[i].Cap = nodeCap(node)
+		if incomplete(node) {
 			suppliers[i].Cap = 0
-			fmt.Println("node", node.Node, "is incomplete")
 		}
 		suppliers[i].CapRest = suppliers[i].Cap
 		suppliers[i].Priority = int64(node.Priority*1000) + 1
 		suppliers[i].Info = node
-		if unifier.IsDeputy(ds.Location{ISP: node.ISP, Province: node.Province}) {
+		suppliers[i].ExtraCap = extraCaps(node)
+		suppliers[i].ExtraCapRest = append([]int64(nil), suppliers[i].ExtraCap...)
+		suppliers[i].MaxBuyers = node.MaxViews
+		suppliers[i].BuyersRest = node.MaxViews
+		suppliers[i].Domain = node.Domain
+		if unifier.IsDeputy(node.location()) {
 			ispBW[location.ISP] += suppliers[i].Cap
 		}
 	}
@@ -249,9 +444,112 @@ func genSuppliers(unifier ds.LocationUnifier, nodes NodeSet) (supplierSet, int,
 	return supplierSet{suppliers}, len(suppliers), ispBW
 }
 
+// The extra dimensions of rsdmatch.Supplier.ExtraCap and rsdmatch.Buyer.ExtraDemand.
+const (
+	extraStorage = iota // GB
+	extraConns
+	extraCount
+)
+
+func extraCaps(node *Node) []int64 {
+	caps := make([]int64, extraCount)
+	caps[extraStorage] = int64(math.Floor(node.Storage * 1000))
+	caps[extraConns] = node.Conns
+	for k := range caps {
+		if caps[k] <= 0 {
+			caps[k] = -1 // unlimited
+		}
+	}
+	return caps
+}
+
+func extraDemands(view *View) []int64 {
+	demands := make([]int64, extraCount)
+	demands[extraStorage] = int64(math.Ceil(view.Storage * 1000))
+	demands[extraConns] = view.Conns
+	return demands
+}
+
+func nodeCap(node *Node) int64 {
+	return int64(math.Floor(node.Bandwidth * float64(1000/bwUnit)))
+}
+
+func (node *Node) location() ds.Location {
+	return ds.Location{ISP: node.ISP, Province: node.Province, City: node.City}
+}
+
+func (view *View) location() ds.Location {
+	return ds.Location{ISP: view.ISP, Province: view.Province, City: view.City}
+}
+
+// resolve returns the nodes and views located by Matcher.Resolver, the resolved ones
+// are copied.
+func (m *Matcher) resolve(nodes NodeSet, viewss []ViewSet) (NodeSet, []ViewSet) {
+	if m.Resolver == nil {
+		return nodes, viewss
+	}
+
+	resolvedNodes := NodeSet{Elems: make([]*Node, len(nodes.Elems))}
+	for i, node := range nodes.Elems {
+		resolvedNodes.Elems[i] = node
+		if node.ISP != "" && node.Province != "" {
+			continue
+		}
+		if l, ok := m.resolveIP(node.IP); ok {
+			copied := *node
+			fillLocation(&copied.ISP, &copied.Province, &copied.City, l)
+			resolvedNodes.Elems[i] = &copied
+		}
+	}
+
+	resolvedViewss := make([]ViewSet, len(viewss))
+	for k, views := range viewss {
+		resolvedViewss[k] = views
+		resolvedViewss[k].Elems = make([]*View, len(views.Elems))
+		for i, view := range views.Elems {
+			resolvedViewss[k].Elems[i] = view
+			if view.ISP != "" && view.Province != "" {
+				continue
+			}
+			if l, ok := m.resolveIP(view.IP); ok {
+				copied := *view
+				fillLocation(&copied.ISP, &copied.Province, &copied.City, l)
+				resolvedViewss[k].Elems[i] = &copied
+			}
+		}
+	}
+	return resolvedNodes, resolvedViewss
+}
+
+func (m *Matcher) resolveIP(s string) (ds.Location, bool) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return ds.Location{}, false
+	}
+	return m.Resolver.Resolve(ip)
+}
+
+// fillLocation fills the empty fields by l, the city is filled only in the same province.
+func fillLocation(isp, province, city *string, l ds.Location) {
+	if *isp == "" {
+		*isp = l.ISP
+	}
+	if *province == "" {
+		*province = l.Province
+	}
+	if *city == "" && *province == l.Province {
+		*city = l.City
+	}
+}
+
+func incomplete(node *Node) bool {
+	return node.ISP == "" || node.Province == ""
+}
+
 type buyerSet struct {
-	Elems  []rsdmatch.Buyer
-	Option *ViewOption
+	Elems    []rsdmatch.Buyer
+	Option   *ViewOption
+	Previous *RingSet
 }
 
 func genBuyerss(unifier ds.LocationUnifier, viewss []ViewSet, ispScale map[string]float64) ([]buyerSet, int, map[string]int64) {
@@ -261,10 +559,15 @@ func genBuyerss(unifier ds.LocationUnifier, viewss []ViewSet, ispScale map[strin
 	var buyerss []buyerSet
 
 	for _, views := range viewss {
+		option := views.Option
+		if option == nil {
+			option = DefaultViewOption
+		}
+
 		buyers := make([]rsdmatch.Buyer, len(views.Elems))
 
 		for i, view := range views.Elems {
-			location := unifier.Unify(ds.Location{ISP: view.ISP, Province: view.Province}, false)
+			location := unifier.Unify(view.location(), false)
 			buyers[i].ID = view.View
 			scale := 1.0
 			if s, ok := ispScale[location.ISP]; ok {
@@ -272,23 +575,25 @@ func genBuyerss(unifier ds.LocationUnifier, viewss []ViewSet, ispScale map[strin
 			}
 			buyers[i].Demand = int64(math.Ceil(view.Bandwidth * scale * float64(1000/bwUnit)))
 			buyers[i].DemandRest = buyers[i].Demand
+			buyers[i].Priority = view.Priority
+			buyers[i].MaxShare = option.MaxNodeShare
+			if view.MaxShare > 0.0 {
+				buyers[i].MaxShare = view.MaxShare
+			}
+			buyers[i].MaxDomainShare = option.MaxDomainShare
+			buyers[i].MinDomains = option.MinDomains
 			buyers[i].Info = view
-			if unifier.IsDeputy(ds.Location{ISP: view.ISP, Province: view.Province}) {
+			buyers[i].ExtraDemand = extraDemands(view)
+			if unifier.IsDeputy(view.location()) {
 				ispBW[location.ISP] += buyers[i].Demand
 			}
 		}
 
 		sort.Slice(buyers, func(i, j int) bool {
-			return buyers[i].Demand > buyers[j].Demand
+			return rsdmatch.BuyerLess(&buyers[i], &buyers[j])
 		})
 
-		option := views.Option
-		if option == nil {
-			option = DefaultViewOption
-		}
-		option.Fix()
-
-		buyerss = append(buyerss, buyerSet{buyers, option})
+		buyerss = append(buyerss, buyerSet{buyers, option, views.Previous})
 		count += len(buyers)
 	}
 
@@ -303,11 +608,22 @@ func mergeBuyers(unifier ds.LocationUnifier, raws []rsdmatch.Buyer) (merged []rs
 	next := 0
 	for _, buyer := range raws {
 		view := buyer.Info.(*View)
-		location := unifier.Unify(ds.Location{ISP: view.ISP, Province: view.Province}, false)
-		buyerID := location.Province + "-" + location.ISP
+		buyerID := mergedBuyerID(unifier, view)
 		if idx, ok := indexes[buyerID]; ok {
 			merged[idx].Demand += buyer.Demand
 			merged[idx].DemandRest = merged[idx].Demand
+			if buyer.Priority > merged[idx].Priority {
+				merged[idx].Priority = buyer.Priority
+			}
+			if share := buyer.MaxShare; share > 0.0 && (merged[idx].MaxShare <= 0.0 || share < merged[idx].MaxShare) {
+				merged[idx].MaxShare = share
+			}
+			for k, demand := range buyer.ExtraDemand {
+				if k >= len(merged[idx].ExtraDemand) {
+					merged[idx].ExtraDemand = append(merged[idx].ExtraDemand, 0)
+				}
+				merged[idx].ExtraDemand[k] += demand
+			}
 			buyerViews[buyerID] = append(buyerViews[buyerID], buyer.ID)
 		} else {
 			idx = next
@@ -315,7 +631,12 @@ func mergeBuyers(unifier ds.LocationUnifier, raws []rsdmatch.Buyer) (merged []rs
 			merged[idx].ID = buyerID
 			merged[idx].Demand = buyer.Demand
 			merged[idx].DemandRest = merged[idx].Demand
+			merged[idx].Priority = buyer.Priority
+			merged[idx].MaxShare = buyer.MaxShare
+			merged[idx].MaxDomainShare = buyer.MaxDomainShare
+			merged[idx].MinDomains = buyer.MinDomains
 			merged[idx].Info = view
+			merged[idx].ExtraDemand = append([]int64(nil), buyer.ExtraDemand...)
 			buyerViews[buyerID] = []string{buyer.ID}
 			indexes[buyerID] = idx
 		}
@@ -324,11 +645,21 @@ func mergeBuyers(unifier ds.LocationUnifier, raws []rsdmatch.Buyer) (merged []rs
 
 	merged = merged[0:next]
 	sort.Slice(merged, func(i, j int) bool {
-		return merged[i].Demand > merged[j].Demand
+		return rsdmatch.BuyerLess(&merged[i], &merged[j])
 	})
 	return
 }
 
+// mergedBuyerID returns the buyer ID of the view merged by location, the views of
+// different cities are not merged.
+func mergedBuyerID(unifier ds.LocationUnifier, view *View) string {
+	location := unifier.Unify(view.location(), false)
+	if location.City != "" {
+		return location.Province + "-" + location.City + "-" + location.ISP
+	}
+	return location.Province + "-" + location.ISP
+}
+
 func genRings(matches rsdmatch.Matches, buyerViews map[string][]string, buyerDemand map[string]int64) RingSet {
 	var rings []*Ring
 
@@ -370,3 +701,34 @@ func genRings(matches rsdmatch.Matches, buyerViews map[string][]string, buyerDem
 
 	return RingSet{rings}
 }
+
+// ringMatches converts the rings to matches keyed by ring name, the amounts are in Mbps.
+func ringMatches(rs *RingSet) rsdmatch.Matches {
+	matches := make(rsdmatch.Matches, len(rs.Elems))
+	for _, ring := range rs.Elems {
+		var records []rsdmatch.BuyRecord
+		for _, group := range ring.Groups {
+			for i, node := range group.Nodes {
+				records = append(records, rsdmatch.BuyRecord{SupplierID: node, Amount: group.NodesWeight[i]})
+			}
+		}
+		matches[ring.Name] = records
+	}
+	return matches
+}
+
+// previousMatches converts the previous rings to matches keyed by buyer ID, the rings
+// of the merged views are united.
+func previousMatches(prev *RingSet, buyerViews map[string][]string) rsdmatch.Matches {
+	matches := ringMatches(prev)
+	if buyerViews == nil {
+		return matches
+	}
+	merged := make(rsdmatch.Matches, len(buyerViews))
+	for buyerID, views := range buyerViews {
+		for _, view := range views {
+			merged[buyerID] = append(merged[buyerID], matches[view]...)
+		}
+	}
+	return merged
+}
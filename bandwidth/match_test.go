@@ -5,12 +5,18 @@
 package bandwidth
 
 import (
+	"context"
+	"encoding/json"
 	"math"
+	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/someonegg/rsdmatch"
 	ds "github.com/someonegg/rsdmatch/distscore"
 	"github.com/someonegg/rsdmatch/distscore/china"
+	"github.com/someonegg/rsdmatch/distscore/ipdb"
 )
 
 // 辅助函数
@@ -199,8 +205,13 @@ func TestMergeBuyers(t *testing.T) {
 			t.Errorf("Expected 2 merged buyers, got %d", len(merged))
 		}
 
-		// 北京-电信的总需求应该是 10+20=30
-		beijingBuyer := merged[0]
+		// 北京-电信的总需求应该是 10+20=30，与上海-联通相同，按 ID 排序
+		var beijingBuyer rsdmatch.Buyer
+		for _, buyer := range merged {
+			if buyer.Info.(*View).Province == "北京" {
+				beijingBuyer = buyer
+			}
+		}
 		if beijingBuyer.Demand != 30 {
 			t.Errorf("Expected Beijing demand 30, got %d", beijingBuyer.Demand)
 		}
@@ -533,6 +544,85 @@ func TestMatcher_Match(t *testing.T) {
 			t.Error("Expected each ring to have 1 group")
 		}
 	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		nodes := NodeSet{
+			Elems: []*Node{
+				makeNode("node1", "电信", "北京", 1.0, 1.0),
+			},
+		}
+
+		viewss := []ViewSet{
+			{
+				Elems: []*View{
+					makeView("view1", "电信", "北京", 0.5),
+				},
+			},
+		}
+
+		matcher := &Matcher{
+			Unifier: unifier,
+			Scorer:  scorer,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		ringss, summ, err := matcher.MatchContext(ctx, nodes, viewss)
+
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if !summ.Incomplete {
+			t.Error("Expected summary to be incomplete")
+		}
+		if len(ringss) != 1 || len(ringss[0].Elems) != 0 {
+			t.Errorf("Expected 1 empty RingSet, got %v", ringss)
+		}
+		if summ.BandwidthNeeds != 0.5 {
+			t.Errorf("Expected BandwidthNeeds 0.5, got %f", summ.BandwidthNeeds)
+		}
+	})
+
+	t.Run("Optimal", func(t *testing.T) {
+		nodes := NodeSet{
+			Elems: []*Node{
+				makeNode("node1", "电信", "北京", 1.0, 1.0),
+				makeNode("node2", "电信", "上海", 1.0, 1.0),
+			},
+		}
+
+		viewss := []ViewSet{
+			{
+				Elems: []*View{
+					makeView("view1", "电信", "北京", 1.0),
+					makeView("view2", "电信", "上海", 1.0),
+				},
+			},
+		}
+
+		matcher := &Matcher{
+			Unifier: unifier,
+			Scorer:  scorer,
+			Optimal: true,
+		}
+
+		ringss, summ := matcher.Match(nodes, viewss)
+
+		if summ.BandwidthNeeds != 0 {
+			t.Errorf("Expected BandwidthNeeds 0, got %f", summ.BandwidthNeeds)
+		}
+		// 每个 view 都应该使用本省节点
+		for _, ring := range ringss[0].Elems {
+			nodes := ring.Groups[0].Nodes
+			if len(nodes) != 1 {
+				t.Errorf("Expected ring %s to have 1 node, got %v", ring.Name, nodes)
+				continue
+			}
+			if ring.Name == "view1" && nodes[0] != "node1" || ring.Name == "view2" && nodes[0] != "node2" {
+				t.Errorf("Unexpected ring %s nodes %v", ring.Name, nodes)
+			}
+		}
+	})
 }
 
 // 7. 测试 genRings
@@ -661,8 +751,11 @@ func TestViewOption_Fix(t *testing.T) {
 			RemoteAccessLimit: 1.5, // 无效值，应该被修正
 		}
 
-		option.Fix()
+		fixed := option.Fix()
 
+		if len(fixed) == 0 || fixed[0] != "RemoteAccessLimit" {
+			t.Errorf("Expected RemoteAccessLimit reported, got %v", fixed)
+		}
 		if option.RemoteAccessLimit != DefaultViewOption.RemoteAccessLimit {
 			t.Errorf("Expected RemoteAccessLimit to be fixed to default, got %f", option.RemoteAccessLimit)
 		}
@@ -771,3 +864,1031 @@ func TestDeputy(t *testing.T) {
 		}
 	})
 }
+
+// 13. 测试 affinityTable.Candidates
+func TestAffinityTable_Candidates(t *testing.T) {
+	unifier := china.NewLocationUnifier(false)
+	scorer := china.NewDistScorer()
+
+	option := &ViewOption{
+		RemoteAccessScore: 50.0,
+		RejectScore:       80.0,
+		RemoteAccessLimit: 0.1,
+		NodeFilter: func(n *Node, v *View) bool {
+			return n.Node != "node5"
+		},
+	}
+
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("node1", "电信", "北京", 1.0, 1.0),
+			makeNode("node2", "电信", "广东", 1.0, 1.0),
+			makeNode("node3", "联通", "上海", 1.0, 1.0), // 跨运营商，拒绝
+			makeNode("node4", "电信", "新疆", 1.0, 1.0),
+			makeNode("node5", "电信", "北京", 1.0, 1.0), // 被过滤
+			makeNode("node6", "电信", "天津", 1.0, 1.0),
+		},
+	}
+	nodes.Elems[5].LocalOnly = true // 非本地，拒绝
+
+	suppliers, _, _ := genSuppliers(unifier, nodes)
+	buyer := &rsdmatch.Buyer{ID: "view1", Demand: 10, Info: makeView("view1", "电信", "北京", 1.0)}
+
+	table := newAffinityTable(option, unifier, scorer)
+	candidates := table.(rsdmatch.CandidateTable).Candidates(suppliers.Elems, buyer)
+
+	// 与 Find 的结果一致：只包含 limit > 0 的节点，按下标升序
+	var expected []int
+	for i := range suppliers.Elems {
+		a := table.Find(&suppliers.Elems[i], buyer)
+		if a.Limit == nil || a.Limit.Calculate(suppliers.Elems[i].Cap, buyer.Demand) > 0 {
+			expected = append(expected, i)
+		}
+	}
+	if len(candidates) != len(expected) {
+		t.Fatalf("Expected %d candidates, got %d", len(expected), len(candidates))
+	}
+	for k, c := range candidates {
+		if c.Supplier != expected[k] {
+			t.Errorf("Expected candidate %d, got %d", expected[k], c.Supplier)
+		}
+		a := table.Find(&suppliers.Elems[c.Supplier], buyer)
+		if a.Price != c.Affinity.Price {
+			t.Errorf("Expected price %f, got %f", a.Price, c.Affinity.Price)
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, c := range candidates {
+		ids[suppliers.Elems[c.Supplier].ID] = true
+	}
+	if !ids["node1"] || !ids["node2"] || !ids["node4"] {
+		t.Errorf("Expected node1, node2 and node4 to be candidates, got %v", ids)
+	}
+	if ids["node3"] || ids["node5"] || ids["node6"] {
+		t.Errorf("Expected node3, node5 and node6 to be excluded, got %v", ids)
+	}
+}
+
+// 14. 测试 Tracer 事件
+func TestMatcher_Tracer(t *testing.T) {
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("node1", "电信", "北京", 1.0, 1.0),
+			makeNode("node2", "", "北京", 1.0, 1.0), // ISP 为空
+		},
+	}
+	viewss := []ViewSet{
+		{
+			Elems: []*View{
+				makeView("view1", "电信", "北京", 0.5),
+			},
+			Option: &ViewOption{
+				EnoughNodeCount:   5,
+				RemoteAccessScore: 50.0,
+				RejectScore:       80.0,
+				RemoteAccessLimit: 2.0, // 无效值
+				ScoreSensitivity:  25.0,
+			},
+		},
+	}
+
+	rec := &rsdmatch.Recorder{}
+	matcher := &Matcher{
+		Tracer: rec,
+	}
+	matcher.Match(nodes, viewss)
+
+	var (
+		fixed      []string
+		incomplete []string
+		allocated  int
+	)
+	for _, e := range rec.Events {
+		switch e := e.(type) {
+		case OptionFixed:
+			fixed = append(fixed, e.Field)
+		case NodeIncomplete:
+			incomplete = append(incomplete, e.Node)
+		case rsdmatch.Allocated:
+			allocated++
+		}
+	}
+	if len(fixed) != 1 || fixed[0] != "RemoteAccessLimit" {
+		t.Errorf("Expected RemoteAccessLimit fixed, got %v", fixed)
+	}
+	if len(incomplete) != 1 || incomplete[0] != "node2" {
+		t.Errorf("Expected node2 incomplete, got %v", incomplete)
+	}
+	if allocated == 0 {
+		t.Error("Expected allocated events from the underlying matcher")
+	}
+}
+
+// 15. 测试输入顺序无关
+func TestMatcher_PermutationInvariant(t *testing.T) {
+	newInput := func() (NodeSet, []ViewSet) {
+		nodes := NodeSet{
+			Elems: []*Node{
+				makeNode("node1", "电信", "北京", 1.0, 1.0),
+				makeNode("node2", "电信", "北京", 1.0, 1.0),
+				makeNode("node3", "电信", "天津", 1.0, 1.0),
+				makeNode("node4", "联通", "上海", 2.0, 1.0),
+				makeNode("node5", "联通", "江苏", 1.0, 0.5),
+			},
+		}
+		viewss := []ViewSet{
+			{
+				Elems: []*View{
+					makeView("view1", "电信", "北京", 0.8),
+					makeView("view2", "电信", "河北", 0.8),
+					makeView("view3", "联通", "上海", 0.8),
+					makeView("view4", "联通", "浙江", 0.8),
+					makeView("view5", "电信", "天津", 0.5),
+				},
+			},
+		}
+		return nodes, viewss
+	}
+
+	for _, merge := range []bool{false, true} {
+		nodes, viewss := newInput()
+		expected, _ := (&Matcher{AutoMergeView: merge}).Match(nodes, viewss)
+		if len(expected) != 1 || len(expected[0].Elems) == 0 {
+			t.Fatalf("Expected rings, got %v", expected)
+		}
+
+		for seed := int64(0); seed < 5; seed++ {
+			r := rand.New(rand.NewSource(seed))
+			nodes, viewss := newInput()
+			r.Shuffle(len(nodes.Elems), func(i, j int) {
+				nodes.Elems[i], nodes.Elems[j] = nodes.Elems[j], nodes.Elems[i]
+			})
+			views := viewss[0].Elems
+			r.Shuffle(len(views), func(i, j int) { views[i], views[j] = views[j], views[i] })
+
+			ringss, _ := (&Matcher{AutoMergeView: merge}).Match(nodes, viewss)
+			if !reflect.DeepEqual(ringss, expected) {
+				t.Fatalf("merge %v, seed %d: permutation changed the rings", merge, seed)
+			}
+		}
+	}
+}
+
+// 16. 测试粘性匹配
+func TestMatcher_Sticky(t *testing.T) {
+	newInput := func() (NodeSet, []ViewSet) {
+		nodes := NodeSet{
+			Elems: []*Node{
+				makeNode("node1", "电信", "北京", 1.0, 1.0),
+				makeNode("node2", "电信", "天津", 1.0, 1.0),
+			},
+		}
+		viewss := []ViewSet{
+			{
+				Elems: []*View{
+					makeView("view1", "电信", "北京", 0.5),
+				},
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 1.0,
+					ScoreSensitivity:  10.0,
+				},
+			},
+		}
+		return nodes, viewss
+	}
+
+	// 之前 view1 分配在 node2（天津）
+	prev := &RingSet{
+		Elems: []*Ring{
+			{Name: "view1", Groups: []Group{{Nodes: []string{"node2"}, NodesWeight: []int64{500}}}},
+		},
+	}
+
+	t.Run("WithoutStickiness", func(t *testing.T) {
+		nodes, viewss := newInput()
+		viewss[0].Previous = prev
+
+		ringss, summ := (&Matcher{}).Match(nodes, viewss)
+		if nodes := ringss[0].Elems[0].Groups[0].Nodes; len(nodes) != 1 || nodes[0] != "node1" {
+			t.Fatalf("Expected view1 on node1, got %v", nodes)
+		}
+		if summ.Moved != 1 || summ.MovedBandwidth != 0.5 {
+			t.Errorf("Expected 1 moved assignment of 0.5Gbps, got %d %f", summ.Moved, summ.MovedBandwidth)
+		}
+	})
+
+	t.Run("WithStickiness", func(t *testing.T) {
+		nodes, viewss := newInput()
+		viewss[0].Previous = prev
+		viewss[0].Option.Stickiness = 50.0
+
+		ringss, summ := (&Matcher{}).Match(nodes, viewss)
+		if nodes := ringss[0].Elems[0].Groups[0].Nodes; len(nodes) != 1 || nodes[0] != "node2" {
+			t.Fatalf("Expected view1 to stay on node2, got %v", nodes)
+		}
+		if summ.Moved != 0 {
+			t.Errorf("Expected no moved assignment, got %d", summ.Moved)
+		}
+	})
+
+	t.Run("MergedViews", func(t *testing.T) {
+		merged := previousMatches(prev, map[string][]string{"北京-电信": {"view1", "view2"}})
+		if len(merged["北京-电信"]) != 1 || merged["北京-电信"][0].SupplierID != "node2" {
+			t.Errorf("Unexpected merged previous matches %v", merged)
+		}
+	})
+}
+
+// 17. 测试存储与连接数容量
+func TestMatcher_ExtraCap(t *testing.T) {
+	node1 := makeNode("node1", "电信", "北京", 1.0, 1.0)
+	node1.Storage = 1.0 // TB
+	node2 := makeNode("node2", "电信", "北京", 1.0, 1.0)
+	nodes := NodeSet{Elems: []*Node{node1, node2}}
+
+	view := makeView("view1", "电信", "北京", 1.0)
+	view.Storage = 4.0 // TB，node1 最多承担 1/4 带宽
+	viewss := []ViewSet{
+		{
+			Elems: []*View{view},
+			Option: &ViewOption{
+				EnoughNodeCount:   1,
+				RemoteAccessScore: 50.0,
+				RejectScore:       80.0,
+				RemoteAccessLimit: 0.1,
+				ScoreSensitivity:  10.0,
+			},
+		},
+	}
+
+	ringss, summ := (&Matcher{}).Match(nodes, viewss)
+
+	if summ.BandwidthNeeds != 0 {
+		t.Errorf("Expected all demand satisfied, got %f", summ.BandwidthNeeds)
+	}
+	group := ringss[0].Elems[0].Groups[0]
+	for i, node := range group.Nodes {
+		if node == "node1" && group.NodesWeight[i] > 250 {
+			t.Errorf("Expected node1 weight <= 250Mbps, got %d", group.NodesWeight[i])
+		}
+	}
+
+	suppliers, _, _ := genSuppliers(china.NewLocationUnifier(false), nodes)
+	if suppliers.Elems[0].ExtraCap[extraStorage] != 1000 || suppliers.Elems[1].ExtraCap[extraStorage] != -1 {
+		t.Errorf("Unexpected ExtraCap %v %v", suppliers.Elems[0].ExtraCap, suppliers.Elems[1].ExtraCap)
+	}
+}
+
+// 18. 测试优先级与公平性
+func TestMatcher_Fairness(t *testing.T) {
+	newInput := func(fairness string) (NodeSet, []ViewSet) {
+		nodes := NodeSet{
+			Elems: []*Node{
+				makeNode("node1", "电信", "北京", 0.6, 1.0),
+			},
+		}
+		viewss := []ViewSet{
+			{
+				Elems: []*View{
+					makeView("view1", "电信", "北京", 0.6),
+					makeView("view2", "电信", "北京", 0.2),
+				},
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.1,
+					ScoreSensitivity:  10.0,
+					Fairness:          fairness,
+				},
+			},
+		}
+		return nodes, viewss
+	}
+
+	weights := func(ringss []RingSet) map[string]int64 {
+		w := make(map[string]int64)
+		for _, ring := range ringss[0].Elems {
+			for _, group := range ring.Groups {
+				for _, weight := range group.NodesWeight {
+					w[ring.Name] += weight
+				}
+			}
+		}
+		return w
+	}
+
+	t.Run("MaxMin", func(t *testing.T) {
+		nodes, viewss := newInput(rsdmatch.MaxMinFair)
+		ringss, _ := (&Matcher{}).Match(nodes, viewss)
+		if w := weights(ringss); w["view1"] != 400 || w["view2"] != 200 {
+			t.Errorf("Unexpected weights %v", w)
+		}
+	})
+
+	t.Run("Priority", func(t *testing.T) {
+		nodes, viewss := newInput("")
+		viewss[0].Elems[1].Priority = 1
+		viewss[0].Elems[1].Bandwidth = 0.5
+		ringss, _ := (&Matcher{}).Match(nodes, viewss)
+		if w := weights(ringss); w["view1"] != 100 || w["view2"] != 500 {
+			t.Errorf("Unexpected weights %v", w)
+		}
+	})
+
+	t.Run("InvalidFairness", func(t *testing.T) {
+		option := &ViewOption{RemoteAccessLimit: 0.1, ScoreSensitivity: 10.0, Fairness: "unknown"}
+		if fixed := option.Fix(); len(fixed) != 1 || fixed[0] != "Fairness" || option.Fairness != "" {
+			t.Errorf("Expected Fairness fixed, got %v %q", fixed, option.Fairness)
+		}
+	})
+}
+
+// 19. 测试匹配结果验证
+func TestMatcher_Verify(t *testing.T) {
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("node1", "电信", "北京", 1.0, 1.0),
+			makeNode("node2", "电信", "天津", 1.0, 1.0),
+			makeNode("node3", "联通", "上海", 2.0, 1.0),
+		},
+	}
+
+	for _, exclusive := range []bool{false, true} {
+		for _, optimal := range []bool{false, true} {
+			viewss := []ViewSet{
+				{
+					Elems: []*View{
+						makeView("view1", "电信", "北京", 1.5),
+						makeView("view2", "电信", "河北", 0.5),
+						makeView("view3", "联通", "上海", 1.0),
+					},
+					Option: &ViewOption{
+						EnoughNodeCount:   2,
+						RemoteAccessScore: 50.0,
+						RejectScore:       80.0,
+						RemoteAccessLimit: 0.5,
+						ScoreSensitivity:  10.0,
+						ExclusiveMode:     exclusive,
+					},
+				},
+			}
+
+			_, summ := (&Matcher{Optimal: optimal, AutoMergeView: true}).Match(nodes, viewss)
+			if len(summ.Violations) != 0 {
+				t.Errorf("exclusive %v, optimal %v: unexpected violations %v", exclusive, optimal, summ.Violations)
+			}
+		}
+	}
+}
+
+// 20. 测试最小带宽与粒度
+func TestMatcher_MinBandwidth(t *testing.T) {
+	var elems []*Node
+	for i := 0; i < 10; i++ {
+		elems = append(elems, makeNode(string(rune('a'+i)), "电信", "北京", 1.0, 1.0))
+	}
+	nodes := NodeSet{Elems: elems}
+
+	newViewss := func(minBW, step float64) []ViewSet {
+		return []ViewSet{
+			{
+				Elems: []*View{
+					makeView("view1", "电信", "北京", 0.5),
+				},
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.1,
+					ScoreSensitivity:  10.0,
+					MinBandwidth:      minBW,
+					BandwidthStep:     step,
+				},
+			},
+		}
+	}
+
+	weights := func(minBW, step float64) []int64 {
+		ringss, _ := (&Matcher{}).Match(nodes, newViewss(minBW, step))
+		return ringss[0].Elems[0].Groups[0].NodesWeight
+	}
+
+	for _, w := range weights(0, 0) {
+		if w != 100 {
+			t.Errorf("Expected weight 100 without minimum, got %d", w)
+		}
+	}
+	for _, w := range weights(0.3, 0) {
+		if w < 200 {
+			t.Errorf("Expected weight >= 200 with minimum, got %d", w)
+		}
+	}
+	for _, w := range weights(0, 0.25) {
+		if w%300 != 0 {
+			t.Errorf("Expected weight in multiples of 300 with step, got %d", w)
+		}
+	}
+}
+
+// 21. 测试节点最大视图数
+func TestMatcher_MaxViews(t *testing.T) {
+	var elems []*Node
+	for i := 0; i < 4; i++ {
+		node := makeNode(string(rune('a'+i)), "电信", "北京", 1.0, 1.0)
+		node.MaxViews = 2
+		elems = append(elems, node)
+	}
+	nodes := NodeSet{Elems: elems}
+
+	var views []*View
+	for i := 0; i < 4; i++ {
+		views = append(views, makeView(string(rune('p'+i)), "电信", "北京", 0.5))
+	}
+	viewss := []ViewSet{
+		{
+			Elems: views,
+			Option: &ViewOption{
+				EnoughNodeCount:   2,
+				RemoteAccessScore: 50.0,
+				RejectScore:       80.0,
+				RemoteAccessLimit: 0.1,
+				ScoreSensitivity:  10.0,
+			},
+		},
+	}
+
+	ringss, summ := (&Matcher{}).Match(nodes, viewss)
+	if summ.Violations != nil {
+		t.Errorf("Unexpected violations: %v", summ.Violations)
+	}
+
+	served := make(map[string]int)
+	for _, ring := range ringss[0].Elems {
+		for _, node := range ring.Groups[0].Nodes {
+			served[node]++
+		}
+	}
+	for node, count := range served {
+		if count > 2 {
+			t.Errorf("Expected node %s to serve at most 2 views, got %d", node, count)
+		}
+	}
+	if len(served) != 4 {
+		t.Errorf("Expected all 4 nodes used, got %v", served)
+	}
+}
+
+// 22. 测试单节点占比上限
+func TestMatcher_MaxNodeShare(t *testing.T) {
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("big", "电信", "北京", 10.0, 1.0),
+			makeNode("n1", "电信", "北京", 1.0, 1.0),
+			makeNode("n2", "电信", "北京", 1.0, 1.0),
+		},
+	}
+
+	newViewss := func(optionShare, viewShare float32) []ViewSet {
+		view := makeView("view1", "电信", "北京", 1.0)
+		view.MaxShare = viewShare
+		return []ViewSet{
+			{
+				Elems: []*View{view},
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.1,
+					ScoreSensitivity:  10.0,
+					MaxNodeShare:      optionShare,
+				},
+			},
+		}
+	}
+
+	maxWeight := func(viewss []ViewSet) int64 {
+		ringss, summ := (&Matcher{}).Match(nodes, viewss)
+		if summ.Violations != nil {
+			t.Errorf("Unexpected violations: %v", summ.Violations)
+		}
+		max := int64(0)
+		for _, w := range ringss[0].Elems[0].Groups[0].NodesWeight {
+			if w > max {
+				max = w
+			}
+		}
+		return max
+	}
+
+	if w := maxWeight(newViewss(0.0, 0.0)); w <= 500 {
+		t.Errorf("Expected the big node to take most without share limit, got %d", w)
+	}
+	if w := maxWeight(newViewss(0.5, 0.0)); w > 500 {
+		t.Errorf("Expected at most 500Mbps from a node, got %d", w)
+	}
+	if w := maxWeight(newViewss(0.5, 0.4)); w > 400 {
+		t.Errorf("Expected the view share to override, got %d", w)
+	}
+}
+
+// 23. 测试故障域约束
+func TestMatcher_FailureDomain(t *testing.T) {
+	var elems []*Node
+	for i, domain := range []string{"idc1", "idc1", "idc1", "idc2", "idc3"} {
+		node := makeNode(string(rune('a'+i)), "电信", "北京", 1.0, 1.0)
+		node.Domain = domain
+		elems = append(elems, node)
+	}
+	// idc1 的节点优先级更高
+	for _, node := range elems[:3] {
+		node.Priority = 10.0
+	}
+	nodes := NodeSet{Elems: elems}
+
+	newViewss := func(share float32, domains int) []ViewSet {
+		return []ViewSet{
+			{
+				Elems: []*View{makeView("view1", "电信", "北京", 1.2)},
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.1,
+					ScoreSensitivity:  10.0,
+					MaxDomainShare:    share,
+					MinDomains:        domains,
+				},
+			},
+		}
+	}
+
+	domainWeights := func(viewss []ViewSet) map[string]int64 {
+		ringss, summ := (&Matcher{}).Match(nodes, viewss)
+		if summ.Violations != nil {
+			t.Errorf("Unexpected violations: %v", summ.Violations)
+		}
+		weights := make(map[string]int64)
+		group := ringss[0].Elems[0].Groups[0]
+		for i, id := range group.Nodes {
+			for _, node := range elems {
+				if node.Node == id {
+					weights[node.Domain] += group.NodesWeight[i]
+				}
+			}
+		}
+		return weights
+	}
+
+	if w := domainWeights(newViewss(0.0, 0)); w["idc1"] <= 600 {
+		t.Errorf("Expected idc1 to take most without domain limit, got %v", w)
+	}
+	if w := domainWeights(newViewss(0.5, 0)); w["idc1"] > 600 {
+		t.Errorf("Expected at most 600Mbps from idc1, got %v", w)
+	}
+	if w := domainWeights(newViewss(0.0, 3)); w["idc1"] > 400 || len(w) != 3 {
+		t.Errorf("Expected 3 domains with at most 400Mbps each, got %v", w)
+	}
+}
+
+// 24. 测试 N+1 可用性
+func TestMatcher_Survivability(t *testing.T) {
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("big", "电信", "北京", 10.0, 10.0),
+			makeNode("n1", "电信", "北京", 1.0, 1.0),
+			makeNode("n2", "电信", "北京", 1.0, 1.0),
+			makeNode("far", "电信", "新疆", 1.0, 1.0),
+		},
+	}
+	nodes.Elems[1].Domain = "idc1"
+	nodes.Elems[2].Domain = "idc1"
+
+	newViewss := func(survive float32, domain bool) []ViewSet {
+		return []ViewSet{
+			{
+				Elems: []*View{
+					makeView("view1", "电信", "北京", 1.0),
+				},
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.1,
+					ScoreSensitivity:  10.0,
+					Survivability:     survive,
+					SurviveDomain:     domain,
+				},
+			},
+		}
+	}
+
+	ringss, summ := (&Matcher{}).Match(nodes, newViewss(1.0, false))
+	if summ.Violations != nil || summ.Unsurvivable != nil {
+		t.Errorf("Unexpected violations %v or unsurvivable %v", summ.Violations, summ.Unsurvivable)
+	}
+	group := ringss[0].Elems[0].Groups[0]
+	total, max := int64(0), int64(0)
+	for _, w := range group.NodesWeight {
+		total += w
+		if w > max {
+			max = w
+		}
+	}
+	if total-max < 1000 {
+		t.Errorf("Expected 1000Mbps after losing any node, got %v %v", group.Nodes, group.NodesWeight)
+	}
+
+	// big、n1 与 n2 同属 idc1，idc1 以外只剩远程受限的 far
+	nodes.Elems[0].Domain = "idc1"
+	_, summ = (&Matcher{}).Match(nodes, newViewss(1.0, true))
+	if len(summ.Unsurvivable) != 1 || summ.Unsurvivable[0].Target != 1000 {
+		t.Errorf("Expected view1 unsurvivable, got %v", summ.Unsurvivable)
+	}
+}
+
+// 25. 测试匹配质量指标
+func TestMatcher_Metrics(t *testing.T) {
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("n1", "电信", "北京", 1.0, 1.0),
+			makeNode("n2", "电信", "北京", 1.0, 1.0),
+		},
+	}
+	viewss := []ViewSet{
+		{
+			Elems: []*View{
+				makeView("view1", "电信", "北京", 1.0),
+				makeView("view2", "电信", "北京", 2.0),
+			},
+			Option: &ViewOption{
+				EnoughNodeCount:   1,
+				RemoteAccessScore: 50.0,
+				RejectScore:       80.0,
+				RemoteAccessLimit: 0.1,
+				ScoreSensitivity:  10.0,
+			},
+		},
+	}
+
+	_, summ := (&Matcher{}).Match(nodes, viewss)
+	if len(summ.Metrics) != 1 {
+		t.Fatalf("Expected metrics of 1 view set, got %d", len(summ.Metrics))
+	}
+	x := summ.Metrics[0]
+	if x.Demand != 3000 || x.Matched != 2000 {
+		t.Errorf("Expected demand 3000Mbps and matched 2000Mbps, got %d and %d", x.Demand, x.Matched)
+	}
+	if len(x.Bands) != 3 || x.Bands[0].Amount != 2000 {
+		t.Errorf("Expected all matched near, got %+v", x.Bands)
+	}
+	if x.Utilization.Min != 1.0 {
+		t.Errorf("Expected all nodes used up, got %+v", x.Utilization)
+	}
+	if _, err := json.Marshal(summ); err != nil {
+		t.Errorf("Expected summary in JSON, got %v", err)
+	}
+}
+
+// 26. 测试同分节点按种子打散
+func TestMatcher_Seed(t *testing.T) {
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("n1", "电信", "北京", 10.0, 1.0),
+			makeNode("n2", "电信", "北京", 10.0, 1.0),
+			makeNode("n3", "电信", "北京", 10.0, 1.0),
+			makeNode("n4", "电信", "北京", 10.0, 1.0),
+		},
+	}
+
+	newViewss := func(seed *int64) []ViewSet {
+		var views []*View
+		for i := 0; i < 8; i++ {
+			views = append(views, makeView("view"+string(rune('a'+i)), "电信", "北京", 0.1))
+		}
+		return []ViewSet{
+			{
+				Elems: views,
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.1,
+					ScoreSensitivity:  10.0,
+					Seed:              seed,
+				},
+			},
+		}
+	}
+
+	served := func(seed *int64) (map[string]bool, string) {
+		ringss, _ := (&Matcher{}).Match(nodes, newViewss(seed))
+		used := make(map[string]bool)
+		for _, ring := range ringss[0].Elems {
+			for _, node := range ring.Groups[0].Nodes {
+				used[node] = true
+			}
+		}
+		data, _ := json.Marshal(ringss)
+		return used, string(data)
+	}
+
+	_, unseeded := served(nil)
+
+	seed := int64(42)
+	used, first := served(&seed)
+	if len(used) < 2 {
+		t.Errorf("Expected the views spread over nodes with seed, got %v", used)
+	}
+	if first == unseeded {
+		t.Errorf("Expected the rings shuffled by seed")
+	}
+	if _, second := served(&seed); first != second {
+		t.Errorf("Expected the same rings with the same seed")
+	}
+}
+
+// 27. 测试按优先级精确分配
+func TestMatcher_LargestRemainder(t *testing.T) {
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("n1", "电信", "北京", 10.0, 2.0),
+			makeNode("n2", "电信", "北京", 10.0, 1.0),
+		},
+	}
+
+	weights := func(remainder bool) map[string]int64 {
+		viewss := []ViewSet{
+			{
+				Elems: []*View{makeView("view1", "电信", "北京", 0.5)},
+				Option: &ViewOption{
+					EnoughNodeCount:   2,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.1,
+					ScoreSensitivity:  10.0,
+					LargestRemainder:  remainder,
+				},
+			},
+		}
+		ringss, _ := (&Matcher{}).Match(nodes, viewss)
+		group := ringss[0].Elems[0].Groups[0]
+		ws := make(map[string]int64)
+		for k, node := range group.Nodes {
+			ws[node] = group.NodesWeight[k]
+		}
+		return ws
+	}
+
+	if ws := weights(false); ws["n1"] != 400 || ws["n2"] != 100 {
+		t.Errorf("Expected 400Mbps and 100Mbps with ceil, got %v", ws)
+	}
+	if ws := weights(true); ws["n1"] != 300 || ws["n2"] != 200 {
+		t.Errorf("Expected 300Mbps and 200Mbps, got %v", ws)
+	}
+}
+
+// 28. 测试城市粒度
+func TestMatcher_City(t *testing.T) {
+	makeCityNode := func(id, city string) *Node {
+		node := makeNode(id, "电信", "广东", 10.0, 1.0)
+		node.City = city
+		return node
+	}
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeCityNode("n1", "汕头"),
+			makeCityNode("n2", "广州"),
+		},
+	}
+
+	served := func(city string) []string {
+		view := makeView("view1", "电信", "广东", 1.0)
+		view.City = city
+		viewss := []ViewSet{
+			{
+				Elems: []*View{view},
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.1,
+					ScoreSensitivity:  5.0,
+				},
+			},
+		}
+		ringss, _ := (&Matcher{}).Match(nodes, viewss)
+		return ringss[0].Elems[0].Groups[0].Nodes
+	}
+
+	// 同城节点优先
+	if got := served("广州市"); !reflect.DeepEqual(got, []string{"n2"}) {
+		t.Errorf("Expected the Guangzhou node, got %v", got)
+	}
+	if got := served("汕头"); !reflect.DeepEqual(got, []string{"n1"}) {
+		t.Errorf("Expected the Shantou node, got %v", got)
+	}
+	// 没有城市时按省份匹配
+	if got := served(""); len(got) == 0 {
+		t.Errorf("Expected the nodes of the province, got %v", got)
+	}
+
+	// 不同城市的视图不合并
+	unifier := china.NewLocationUnifier(false)
+	gz := makeView("view1", "电信", "广东", 1.0)
+	gz.City = "广州"
+	st := makeView("view2", "电信", "广东", 1.0)
+	st.City = "汕头"
+	merged, _ := mergeBuyers(unifier, []rsdmatch.Buyer{
+		{ID: "view1", Demand: 10, Info: gz},
+		{ID: "view2", Demand: 10, Info: st},
+		{ID: "view3", Demand: 10, Info: makeView("view3", "电信", "广东", 1.0)},
+	})
+	if len(merged) != 3 {
+		t.Errorf("Expected 3 merged buyers, got %d", len(merged))
+	}
+}
+
+// 29. 测试按 IP 解析位置
+func TestMatcher_Resolver(t *testing.T) {
+	db, err := ipdb.ReadCSV(strings.NewReader("1.2.3.0/24,电信,北京\n2001:db8::/32,电信,广东,广州\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	n1 := &Node{Node: "n1", IP: "1.2.3.4", Bandwidth: 1.0, Priority: 1.0}
+	n2 := &Node{Node: "n2", IP: "5.6.7.8", Bandwidth: 1.0, Priority: 1.0}
+	n3 := &Node{Node: "n3", ISP: "电信", IP: "2001:db8::1", Bandwidth: 1.0, Priority: 1.0}
+	nodes := NodeSet{Elems: []*Node{n1, n2, n3}}
+
+	view := &View{View: "view1", IP: "1.2.3.100", Bandwidth: 0.5}
+	viewss := []ViewSet{
+		{
+			Elems: []*View{view},
+			Option: &ViewOption{
+				EnoughNodeCount:   1,
+				RemoteAccessScore: 50.0,
+				RejectScore:       80.0,
+				RemoteAccessLimit: 0.1,
+				ScoreSensitivity:  10.0,
+			},
+		},
+	}
+
+	// 未设置 Resolver 时所有节点都不完整
+	_, summ := (&Matcher{}).Match(nodes, viewss)
+	if summ.NodesBandwidth != 0 {
+		t.Errorf("Expected no node bandwidth without resolver, got %v", summ.NodesBandwidth)
+	}
+
+	ringss, summ := (&Matcher{Resolver: db}).Match(nodes, viewss)
+	if summ.NodesBandwidth != 2.0 {
+		t.Errorf("Expected 2 nodes resolved, got %v Gbps", summ.NodesBandwidth)
+	}
+	if got := ringss[0].Elems[0].Groups[0].Nodes; !reflect.DeepEqual(got, []string{"n1"}) {
+		t.Errorf("Expected the node in the same province, got %v", got)
+	}
+
+	// 输入不被修改
+	if n1.ISP != "" || n1.Province != "" || view.Province != "" {
+		t.Errorf("Expected the inputs untouched, got %+v and %+v", n1, view)
+	}
+
+	x, err := (&Matcher{Resolver: db}).Explain(nodes, viewss, "view1", "n3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if x.Local || x.Score != 40.0 {
+		t.Errorf("Expected n3 resolved to Guangdong, got %+v", x)
+	}
+}
+
+// 30. 测试故障域约束、N+1 可用性与公平分配同时生效
+func TestMatcher_DomainSurvivableFair(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	domains := []string{"idc1", "idc2", "idc3"}
+	provinces := []string{"北京", "天津"}
+
+	for iter := 0; iter < 300; iter++ {
+		var nodes NodeSet
+		for i, n := 0, 3+r.Intn(6); i < n; i++ {
+			node := makeNode(string(rune('a'+i)), "电信", provinces[r.Intn(len(provinces))],
+				0.5+float64(r.Intn(6))*0.5, float64(1+r.Intn(3)))
+			node.Domain = domains[r.Intn(len(domains))]
+			nodes.Elems = append(nodes.Elems, node)
+		}
+		var views []*View
+		for i, n := 0, 2+r.Intn(3); i < n; i++ {
+			views = append(views, makeView(string(rune('A'+i)), "电信", provinces[r.Intn(len(provinces))],
+				0.5+float64(r.Intn(6))*0.5))
+		}
+		viewss := []ViewSet{
+			{
+				Elems: views,
+				Option: &ViewOption{
+					EnoughNodeCount:   1,
+					RemoteAccessScore: 50.0,
+					RejectScore:       80.0,
+					RemoteAccessLimit: 0.5,
+					ScoreSensitivity:  10.0,
+					MaxDomainShare:    0.5,
+					Survivability:     1.0,
+					Fairness:          rsdmatch.MaxMinFair,
+				},
+			},
+		}
+
+		if _, summ := (&Matcher{}).Match(nodes, viewss); summ.Violations != nil {
+			t.Fatalf("iteration %d: unexpected violations: %v", iter, summ.Violations)
+		}
+	}
+}
+
+// 31. 测试匹配过程的文本输出
+func TestMatcher_TextTrace(t *testing.T) {
+	only := makeNode("n3", "电信", "上海", 1.0, 1.0)
+	only.LocalOnly = true
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("n1", "电信", "北京", 1.0, 1.0),
+			makeNode("n2", "电信", "北京", 1.0, 1.0),
+			only,
+		},
+	}
+	viewss := []ViewSet{
+		{
+			Elems: []*View{
+				makeView("view1", "电信", "北京", 2.0),
+				makeView("view2", "电信", "北京", 1.0),
+			},
+			Option: &ViewOption{
+				EnoughNodeCount:   1,
+				RemoteAccessScore: 50.0,
+				RejectScore:       80.0,
+				RemoteAccessLimit: 0.1,
+				ScoreSensitivity:  10.0,
+			},
+		},
+	}
+
+	var buf strings.Builder
+	matcher := &Matcher{AutoMergeView: true, Tracer: rsdmatch.NewTextTracer(&buf)}
+	matcher.Match(nodes, viewss)
+	out := buf.String()
+
+	buyerID := mergedBuyerID(china.NewLocationUnifier(false), viewss[0].Elems[0])
+	expected := []string{
+		"nodes: 3, views: 2, needs: 3000, has: 3000\n\n",
+		"merged views:\n   [view1 view2]\n\n",
+		"\n" + buyerID + " demand: 3000 demand_rest: 1000\ntotal needs 1000\n\n",
+		"电信 上海 n3 cap: 1000 cap_rest: 1000\ntotal remains 1000\n\n",
+	}
+	for _, s := range expected {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in the output:\n%s", s, out)
+		}
+	}
+	// 逐对的 Considered 事件只发送给 DetailTracer
+	if strings.Contains(out, " tier: ") {
+		t.Errorf("Unexpected considered events in the output:\n%s", out)
+	}
+}
+
+// 32. 测试排他模式下的最优匹配不劣于贪心匹配
+func TestMatcher_OptimalExclusive(t *testing.T) {
+	nodes := NodeSet{
+		Elems: []*Node{
+			makeNode("s00", "电信", "北京", 5.7, 1.0),
+			makeNode("s01", "电信", "北京", 5.4, 1.0),
+		},
+	}
+	viewss := []ViewSet{
+		{
+			Elems: []*View{
+				makeView("b02", "电信", "北京", 11.7),
+				makeView("b01", "电信", "北京", 4.1),
+				makeView("b00", "电信", "北京", 3.3),
+			},
+			Option: &ViewOption{
+				EnoughNodeCount:   1,
+				RemoteAccessScore: 50.0,
+				RejectScore:       80.0,
+				RemoteAccessLimit: 0.1,
+				ScoreSensitivity:  10.0,
+				ExclusiveMode:     true,
+			},
+		},
+	}
+
+	// 按轮次匹配会把 s01 给 b01、s00 给 b02，缺 9.3；贪心把两个节点都给 b02，缺 8.0
+	for _, optimal := range []bool{false, true} {
+		_, summ := (&Matcher{Optimal: optimal}).Match(nodes, viewss)
+		if math.Abs(summ.BandwidthNeeds-8.0) > 1e-9 {
+			t.Errorf("optimal %v: expected BandwidthNeeds 8.0, got %f", optimal, summ.BandwidthNeeds)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/someonegg/rsdmatch"
+)
+
+// OptionFixed is emitted when an invalid field of a ViewOption is reset to default.
+type OptionFixed struct {
+	Field string `json:"field"`
+}
+
+func (e OptionFixed) Kind() string {
+	return "option_fixed"
+}
+
+func (e OptionFixed) String() string {
+	return fmt.Sprint(e.Field, " fixed")
+}
+
+// NodeIncomplete is emitted for the node without ISP or Province, which is not used.
+type NodeIncomplete struct {
+	Node string `json:"node"`
+}
+
+func (e NodeIncomplete) Kind() string {
+	return "node_incomplete"
+}
+
+func (e NodeIncomplete) String() string {
+	return fmt.Sprint("node ", e.Node, " is incomplete")
+}
+
+// MatchStarted is emitted before matching, the bandwidths are in Mbps.
+type MatchStarted struct {
+	Nodes int   `json:"nodes"`
+	Views int   `json:"views"`
+	Needs int64 `json:"needs"`
+	Has   int64 `json:"has"`
+}
+
+func (e MatchStarted) Kind() string {
+	return "match_started"
+}
+
+func (e MatchStarted) String() string {
+	return fmt.Sprintf("nodes: %v, views: %v, needs: %v, has: %v\n", e.Nodes, e.Views, e.Needs, e.Has)
+}
+
+// ViewsMerged is emitted when the views of a ViewSet are merged by Matcher.AutoMergeView,
+// Groups are the views merged into one buyer, the single ones are omitted.
+type ViewsMerged struct {
+	Groups [][]string `json:"groups"`
+}
+
+func (e ViewsMerged) Kind() string {
+	return "views_merged"
+}
+
+func (e ViewsMerged) String() string {
+	var b strings.Builder
+	b.WriteString("merged views:\n")
+	for _, views := range e.Groups {
+		fmt.Fprintln(&b, "  ", views)
+	}
+	return b.String()
+}
+
+// ViewSetMatched is emitted when a ViewSet is matched, before its BuyerShortfall events.
+// Its text is an empty line.
+type ViewSetMatched struct {
+	Index int `json:"index"`
+}
+
+func (e ViewSetMatched) Kind() string {
+	return "view_set_matched"
+}
+
+func (e ViewSetMatched) String() string {
+	return ""
+}
+
+// BuyerShortfall is emitted for the buyer whose demand is not satisfied, the bandwidths
+// are in Mbps.
+type BuyerShortfall struct {
+	BuyerID    string `json:"buyer"`
+	Demand     int64  `json:"demand"`
+	DemandRest int64  `json:"demand_rest"`
+}
+
+func (e BuyerShortfall) Kind() string {
+	return "buyer_shortfall"
+}
+
+func (e BuyerShortfall) String() string {
+	return fmt.Sprint(e.BuyerID, " demand: ", e.Demand, " demand_rest: ", e.DemandRest)
+}
+
+// ShortfallTotal is emitted after the BuyerShortfall events of a ViewSet, when there is
+// any, Needs is in Mbps.
+type ShortfallTotal struct {
+	Needs int64 `json:"needs"`
+}
+
+func (e ShortfallTotal) Kind() string {
+	return "shortfall_total"
+}
+
+func (e ShortfallTotal) String() string {
+	return fmt.Sprint("total needs ", e.Needs, "\n")
+}
+
+// NodeRemains is emitted after matching for the node with capacity left, the bandwidths
+// are in Mbps.
+type NodeRemains struct {
+	ISP      string `json:"isp"`
+	Province string `json:"province"`
+	Node     string `json:"node"`
+	Cap      int64  `json:"cap"`
+	CapRest  int64  `json:"cap_rest"`
+}
+
+func (e NodeRemains) Kind() string {
+	return "node_remains"
+}
+
+func (e NodeRemains) String() string {
+	return fmt.Sprint(e.ISP, " ", e.Province, " ", e.Node, " cap: ", e.Cap, " cap_rest: ", e.CapRest)
+}
+
+// RemainsTotal is emitted after the NodeRemains events, when there is any, Remains is
+// in Mbps.
+type RemainsTotal struct {
+	Remains int64 `json:"remains"`
+}
+
+func (e RemainsTotal) Kind() string {
+	return "remains_total"
+}
+
+func (e RemainsTotal) String() string {
+	return fmt.Sprint("total remains ", e.Remains, "\n")
+}
+
+// tracer returns Matcher.Tracer, or the tracer carried by ctx, or a stdout text tracer
+// when Verbose, or nil.
+func (m *Matcher) tracer(ctx context.Context) rsdmatch.Tracer {
+	if m.Tracer != nil {
+		return m.Tracer
+	}
+	if t := rsdmatch.ContextTracer(ctx); t != nil {
+		return t
+	}
+	if m.Verbose {
+		return rsdmatch.NewTextTracer(os.Stdout)
+	}
+	return nil
+}
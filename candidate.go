@@ -0,0 +1,106 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"math"
+)
+
+// findAffinities calls fn for every (supplier, buyer) pair whose limit is positive,
+// pairs are visited by supplier then buyer, or by buyer then candidate when the
+// affinities is a CandidateTable. It stops early with ctx.Err() when ctx is done.
+func findAffinities(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable,
+	fn func(supplier, buyer int, price float32, limit int64)) error {
+
+	calculate := func(a Affinity, i, j int) int64 {
+		return MaxBuy(a, &suppliers[i], &buyers[j])
+	}
+
+	if ct, ok := affinities.(CandidateTable); ok {
+		for j := 0; j < len(buyers); j++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			for _, c := range ct.Candidates(suppliers, &buyers[j]) {
+				if limit := calculate(c.Affinity, c.Supplier, j); limit > 0 {
+					fn(c.Supplier, j, c.Affinity.Price, limit)
+				}
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < len(suppliers); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for j := 0; j < len(buyers); j++ {
+			a := affinities.Find(&suppliers[i], &buyers[j])
+			if limit := calculate(a, i, j); limit > 0 {
+				fn(i, j, a.Price, limit)
+			}
+		}
+	}
+	return nil
+}
+
+// MaxBuy returns the max amount the buyer can buy from the supplier by the affinity
+// and Buyer.MaxShare, math.MaxInt64 when unlimited.
+func MaxBuy(a Affinity, supplier *Supplier, buyer *Buyer) int64 {
+	limit := int64(math.MaxInt64)
+	if a.Limit != nil {
+		limit = a.Limit.Calculate(supplier.Cap, buyer.Demand)
+	}
+	return minInt64(limit, maxShare(buyer))
+}
+
+// maxShare returns the max amount the buyer can buy from a single supplier.
+func maxShare(buyer *Buyer) int64 {
+	return shareOf(buyer.MaxShare, buyer.Demand)
+}
+
+// shareOf returns ratio of demand but no less than 1, or math.MaxInt64 when the ratio
+// is <= 0 or >= 1.
+func shareOf(ratio float32, demand int64) int64 {
+	if ratio <= 0 || ratio >= 1 {
+		return math.MaxInt64
+	}
+	// Tolerates the float32 precision, e.g. 0.7 is 0.69999999.
+	share := int64(float64(ratio) * float64(demand) * (1 + 1e-6))
+	return maxInt64(share, 1)
+}
+
+type affinityMapper struct {
+	AffinityTable
+	fn func(supplier *Supplier, buyer *Buyer, a Affinity) Affinity
+}
+
+func (t *affinityMapper) Find(supplier *Supplier, buyer *Buyer) Affinity {
+	return t.fn(supplier, buyer, t.AffinityTable.Find(supplier, buyer))
+}
+
+type candidateMapper struct {
+	affinityMapper
+	candidates CandidateTable
+}
+
+func (t *candidateMapper) Candidates(suppliers []Supplier, buyer *Buyer) []Candidate {
+	cs := t.candidates.Candidates(suppliers, buyer)
+	mapped := make([]Candidate, len(cs))
+	for k, c := range cs {
+		mapped[k] = Candidate{c.Supplier, t.fn(&suppliers[c.Supplier], buyer, c.Affinity)}
+	}
+	return mapped
+}
+
+// mapAffinities wraps t to map every affinity it finds by fn, the returned table is a
+// CandidateTable when t is.
+func mapAffinities(t AffinityTable, fn func(supplier *Supplier, buyer *Buyer, a Affinity) Affinity) AffinityTable {
+	if ct, ok := t.(CandidateTable); ok {
+		return &candidateMapper{affinityMapper{t, fn}, ct}
+	}
+	return &affinityMapper{t, fn}
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// mockCandidateTable 在 mockAffinityTable 的基础上实现 CandidateTable
+type mockCandidateTable struct {
+	*mockAffinityTable
+	finds int
+}
+
+func (m *mockCandidateTable) Find(supplier *Supplier, buyer *Buyer) Affinity {
+	m.finds++
+	return m.mockAffinityTable.Find(supplier, buyer)
+}
+
+func (m *mockCandidateTable) Candidates(suppliers []Supplier, buyer *Buyer) []Candidate {
+	var candidates []Candidate
+	for i := range suppliers {
+		if _, ok := m.prices[suppliers[i].ID][buyer.ID]; !ok {
+			continue
+		}
+		candidates = append(candidates, Candidate{i, m.mockAffinityTable.Find(&suppliers[i], buyer)})
+	}
+	return candidates
+}
+
+// 1. 使用 CandidateTable 时结果与 Find 一致，且不调用 Find
+func TestCandidateTable(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, *mockAffinityTable) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 2, nil),
+			makeSupplier("s2", 100, 1, nil),
+			makeSupplier("s3", 50, 1, nil),
+			makeSupplier("s4", 80, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 120, nil),
+			makeBuyer("b2", 100, nil),
+			makeBuyer("b3", 60, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b1", 20.0)
+		affinity.setPrice("s1", "b2", 10.0)
+		affinity.setPrice("s3", "b2", 10.0)
+		affinity.setPrice("s4", "b2", 30.0)
+		affinity.setLimit("s4", "b2", 40)
+		affinity.setPrice("s3", "b3", 20.0)
+		affinity.setPrice("s4", "b3", 10.0)
+		// 其它组合使用默认价格 100，并限制为 0
+		for _, s := range suppliers {
+			for _, b := range buyers {
+				if _, ok := affinity.prices[s.ID][b.ID]; !ok {
+					affinity.setLimit(s.ID, b.ID, 0)
+				}
+			}
+		}
+		return suppliers, buyers, affinity
+	}
+
+	matchers := map[string]Matcher{
+		"Greedy":    GreedyMatcher(1.0, 0.0, 2, false, false),
+		"MinCost":   MinCostMatcher(false),
+		"Exclusive": ExclusiveMatcher(false),
+	}
+
+	for name, matcher := range matchers {
+		t.Run(name, func(t *testing.T) {
+			suppliers, buyers, affinity := newCase()
+			expected, expectedPerfect := matcher.Match(suppliers, buyers, affinity)
+
+			suppliers, buyers, affinity = newCase()
+			table := &mockCandidateTable{mockAffinityTable: affinity}
+			matches, perfect := matcher.Match(suppliers, buyers, table)
+
+			if table.finds != 0 {
+				t.Errorf("Expected no Find calls, got %d", table.finds)
+			}
+			if perfect != expectedPerfect {
+				t.Errorf("Expected perfect %v, got %v", expectedPerfect, perfect)
+			}
+			if !reflect.DeepEqual(matches, expected) {
+				t.Errorf("Expected matches %v, got %v", expected, matches)
+			}
+		})
+	}
+}
+
+// 2. 所有匹配器都遵守买家的单一供应商占比上限
+func TestMatchers_MaxShare(t *testing.T) {
+	if share := maxShare(&Buyer{Demand: 100, MaxShare: 0.7}); share != 70 {
+		t.Errorf("Expected share 70, got %d", share)
+	}
+	if share := maxShare(&Buyer{Demand: 1, MaxShare: 0.5}); share != 1 {
+		t.Errorf("Expected share at least 1, got %d", share)
+	}
+
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		// s1 便宜且足够大，但 b1 最多只能从一个供应商买 40%
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+			makeSupplier("s2", 100, 1, nil),
+			makeSupplier("s3", 100, 1, nil),
+		}
+		b1 := makeBuyer("b1", 100, nil)
+		b1.MaxShare = 0.4
+		buyers := []Buyer{b1}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b1", 20.0)
+		affinity.setPrice("s3", "b1", 30.0)
+		return suppliers, buyers, affinity
+	}
+
+	for name, m := range map[string]Matcher{
+		"Greedy":  GreedyMatcher(1.0, 0.0, 0, false, false),
+		"MinCost": MinCostMatcher(false),
+		"Fair":    FairMatcher(MinCostMatcher(false), MaxMinFair),
+	} {
+		t.Run(name, func(t *testing.T) {
+			suppliers, buyers, affinity := newCase()
+			original := append([]Supplier(nil), suppliers...)
+			matches, perfect := m.Match(suppliers, buyers, affinity)
+
+			if !perfect {
+				t.Fatalf("Expected perfect match, got %v", matches)
+			}
+			if vs := Verify(original, buyers, affinity, matches, false); vs != nil {
+				t.Errorf("Unexpected violations: %v", vs)
+			}
+			for _, record := range matches["b1"] {
+				if record.Amount > 40 {
+					t.Errorf("Expected at most 40 from %s, got %d", record.SupplierID, record.Amount)
+				}
+			}
+		})
+	}
+
+	t.Run("Exclusive", func(t *testing.T) {
+		suppliers, buyers, affinity := newCase()
+		matches, perfect := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+
+		if perfect || len(matches["b1"]) != 0 {
+			t.Errorf("Expected no whole supplier within the share, got %v", matches["b1"])
+		}
+	})
+}
@@ -10,9 +10,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
+	"time"
 
 	bw "github.com/someonegg/rsdmatch/bandwidth"
+	"github.com/someonegg/rsdmatch/distscore"
+	"github.com/someonegg/rsdmatch/distscore/china"
+	"github.com/someonegg/rsdmatch/distscore/ipdb"
+	"github.com/someonegg/rsdmatch/distscore/latency"
+	"github.com/someonegg/rsdmatch/distscore/rule"
 )
 
 type Nodes struct {
@@ -26,6 +33,7 @@ type Node struct {
 
 type View struct {
 	bw.View
+	Storage int64   `json:"storage"`
 	Percent float64 `json:"percent"`
 }
 
@@ -33,11 +41,35 @@ type Rings struct {
 	Views []*bw.Ring `json:"views"`
 }
 
-func doCreate(ctx context.Context, total, scale float64,
-	nodeFile, viewFile, ringFile string,
-	ecn int, ras, rjs float32, ral float32,
-	distMode, storageMode, exclusiveMode, verbose bool) error {
+// createOption is the option of doCreate by the flags of createCmd.
+type createOption struct {
+	Total float64 // Gbps, the bandwidth of the views by percent.
+	Scale float64 // the scale of the bandwidth of the views, auto scale when <= 0.0.
 
+	NodeFile string
+	ViewFile string
+	RingFile string
+
+	// Optional, see the flags.
+	PrevFile    string
+	IPDBFile    string
+	RulesFile   string
+	LatencyFile string
+
+	// The option of the views, ScoreSensitivity and NodeFilter are set by the modes.
+	View bw.ViewOption
+
+	DistMode      bool
+	StorageMode   bool // allocate storage not bandwidth.
+	StorageDemand bool // allocate the storage of the views too.
+	Optimal       bool
+	Verbose       bool
+
+	Timeout time.Duration // the time limit of matching, 0 means unlimited.
+}
+
+func doCreate(ctx context.Context, o *createOption) error {
+	scale := o.Scale
 	autoScale := false
 	if scale <= 0.0 {
 		autoScale = true
@@ -47,21 +79,56 @@ func doCreate(ctx context.Context, total, scale float64,
 	autoMergeView := true
 	proxyMunici := true
 
-	if distMode {
+	if o.DistMode {
 		autoMergeView = false
 		proxyMunici = false
 	}
 
-	nodes, err := loadNodes(nodeFile, storageMode)
+	nodes, err := loadNodes(o.NodeFile, o.StorageMode)
 	if err != nil {
 		return fmt.Errorf("load node file failed: %w", err)
 	}
 
-	views, ispMode, err := loadViews(viewFile, total, scale)
+	views, ispMode, err := loadViews(o.ViewFile, o.Total, scale, o.StorageDemand)
 	if err != nil {
 		return fmt.Errorf("load view file failed: %w", err)
 	}
 
+	var prev *bw.RingSet
+	if o.PrevFile != "" {
+		prev, err = loadRings(o.PrevFile)
+		if err != nil {
+			return fmt.Errorf("load previous ring file failed: %w", err)
+		}
+	}
+
+	var resolver distscore.LocationResolver
+	if o.IPDBFile != "" {
+		resolver, err = loadIPDB(o.IPDBFile)
+		if err != nil {
+			return fmt.Errorf("load ipdb file failed: %w", err)
+		}
+	}
+
+	var scorer distscore.DistScorer
+	if o.RulesFile != "" {
+		scorer, err = loadRules(o.RulesFile)
+		if err != nil {
+			return fmt.Errorf("load rule file failed: %w", err)
+		}
+	}
+	unifier := china.NewLocationUnifier(proxyMunici)
+	if o.LatencyFile != "" {
+		fallback := scorer
+		if fallback == nil {
+			fallback = china.NewDistScorer()
+		}
+		scorer, err = loadLatency(o.LatencyFile, unifier, fallback)
+		if err != nil {
+			return fmt.Errorf("load latency file failed: %w", err)
+		}
+	}
+
 	autoScaleMin, autoScaleMax := 1.0, 10.0
 
 	matcher := &bw.Matcher{
@@ -70,23 +137,23 @@ func doCreate(ctx context.Context, total, scale float64,
 		AutoScaleMax:  &autoScaleMax,
 		AutoMergeView: autoMergeView,
 		ProxyMunici:   proxyMunici,
-		Verbose:       verbose,
+		Unifier:       unifier,
+		Scorer:        scorer,
+		Resolver:      resolver,
+		Optimal:       o.Optimal,
+		Verbose:       o.Verbose,
 	}
 
 	nodeSet := bw.NodeSet{Elems: nodes}
+	vo := o.View
+	vo.NodeFilter = func(n *bw.Node, v *bw.View) bool { return true }
 	viewSet := bw.ViewSet{
-		Elems: views,
-		Option: &bw.ViewOption{
-			EnoughNodeCount:   ecn,
-			RemoteAccessScore: ras,
-			RejectScore:       rjs,
-			RemoteAccessLimit: ral,
-			ExclusiveMode:     exclusiveMode,
-			NodeFilter:        func(n *bw.Node, v *bw.View) bool { return true },
-		},
-	}
-
-	if distMode {
+		Elems:    views,
+		Option:   &vo,
+		Previous: prev,
+	}
+
+	if o.DistMode {
 		fmt.Println("dist mode")
 		mergeByDist(viewSet.Elems)
 		viewSet.Option.ScoreSensitivity = 25.0
@@ -100,10 +167,25 @@ func doCreate(ctx context.Context, total, scale float64,
 		}
 	}
 
-	ringss, summ := matcher.Match(nodeSet, []bw.ViewSet{viewSet})
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	ringss, summ, err := matcher.MatchContext(ctx, nodeSet, []bw.ViewSet{viewSet})
 	fmt.Printf("%+v\n", summ)
+	if err != nil {
+		fmt.Println("matching incomplete:", err)
+	}
+	for _, u := range summ.Unsurvivable {
+		fmt.Println("unsurvivable:", u.BuyerID, "target:", u.Target, "kept:", u.Kept, "lost:", u.Lost)
+	}
+	if len(summ.Violations) > 0 {
+		return fmt.Errorf("matching failed: %w", summ.Violations)
+	}
 
-	err = writeRings(ringFile, ringss[0].Elems)
+	err = writeRings(o.RingFile, ringss[0].Elems)
 	if err != nil {
 		return fmt.Errorf("write ring file failed: %w", err)
 	}
@@ -128,6 +210,8 @@ func loadNodes(file string, storageMode bool) ([]*bw.Node, error) {
 
 	for i, node := range nodes.Nodes {
 		bwns[i] = &node.Node
+		// bytes => TB
+		bwns[i].Storage = float64(node.Storage/1000000) / 1000000.0
 		if !storageMode {
 			continue
 		}
@@ -142,7 +226,7 @@ func loadNodes(file string, storageMode bool) ([]*bw.Node, error) {
 			bwns[i].Bandwidth = 0.0
 		} else {
 			// normalize to TB
-			ratio := float64(node.Storage/1000000) / 1000000.0 / bwns[i].Bandwidth
+			ratio := bwns[i].Storage / bwns[i].Bandwidth
 			if ratio > MaxColdRatio {
 				ratio = MaxColdRatio
 			}
@@ -153,7 +237,7 @@ func loadNodes(file string, storageMode bool) ([]*bw.Node, error) {
 	return bwns, nil
 }
 
-func loadViews(file string, total, scale float64) ([]*bw.View, bool, error) {
+func loadViews(file string, total, scale float64, storageDemand bool) ([]*bw.View, bool, error) {
 	data, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, false, err
@@ -171,6 +255,10 @@ func loadViews(file string, total, scale float64) ([]*bw.View, bool, error) {
 
 	for i, view := range views {
 		bwvs[i] = &view.View
+		if storageDemand {
+			// bytes => TB
+			bwvs[i].Storage = float64(view.Storage/1000000) / 1000000.0
+		}
 		if bwvs[i].Bandwidth == 0.0 {
 			bwvs[i].Bandwidth = view.Percent * total
 		}
@@ -188,7 +276,7 @@ func loadViews(file string, total, scale float64) ([]*bw.View, bool, error) {
 				// 广东-移动
 				bwvs[i].ISP = ss[1]
 				bwvs[i].Province = ss[0]
-			} else {
+			} else if bwvs[i].IP == "" {
 				bwvs[i].Bandwidth = 0.0 // disabled
 			}
 		}
@@ -201,6 +289,84 @@ func loadViews(file string, total, scale float64) ([]*bw.View, bool, error) {
 	return bwvs, ispMode, nil
 }
 
+func loadIPDB(file string) (distscore.LocationResolver, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := ipdb.ReadCSV(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func loadRules(file string) (distscore.DistScorer, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules *rule.Rules
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		rules, err = rule.ReadYAMLRules(bytes.NewReader(data))
+	default:
+		rules, err = rule.ReadRules(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rule.NewDistScorer(rules)
+}
+
+func loadLatency(file string, unifier distscore.LocationUnifier, fallback distscore.DistScorer) (distscore.DistScorer, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []latency.Record
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		records, err = latency.ReadCSV(bytes.NewReader(data))
+	} else {
+		records, err = latency.ReadJSON(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return latency.NewDistScorer(records, unifier, fallback, nil), nil
+}
+
+func loadRings(file string) (*bw.RingSet, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var rings Rings
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&rings); err != nil {
+		return nil, err
+	}
+
+	// MBps, special!!!
+	for _, ring := range rings.Views {
+		for _, group := range ring.Groups {
+			for i := 0; i < len(group.NodesWeight); i++ {
+				group.NodesWeight[i] *= 8
+			}
+		}
+		ring.Demand *= 8
+	}
+
+	return &bw.RingSet{Elems: rings.Views}, nil
+}
+
 func writeRings(file string, rings []*bw.Ring) error {
 	// MBps, special!!!
 	for _, ring := range rings {
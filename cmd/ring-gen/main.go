@@ -6,6 +6,8 @@ import (
 	"os"
 
 	"github.com/urfave/cli/v2"
+
+	bw "github.com/someonegg/rsdmatch/bandwidth"
 )
 
 func main() {
@@ -58,6 +60,30 @@ var createCmd = &cli.Command{
 			Value:    "ring.json",
 			Usage:    "specify the output ring.json",
 		},
+		&cli.StringFlag{
+			Name:     "prev",
+			Required: false,
+			Value:    "",
+			Usage:    "specify the previous ring.json to keep assignments from",
+		},
+		&cli.StringFlag{
+			Name:     "ipdb",
+			Required: false,
+			Value:    "",
+			Usage:    "specify the CIDR table (.csv of prefix,isp,province[,city]) to locate the nodes and views by ip",
+		},
+		&cli.StringFlag{
+			Name:     "rules",
+			Required: false,
+			Value:    "",
+			Usage:    "specify the score rule file (.json, .yaml or .yml) to score by instead of the built-in rules",
+		},
+		&cli.StringFlag{
+			Name:     "latency",
+			Required: false,
+			Value:    "",
+			Usage:    "specify the measured latency file (.csv or .json) to score by, the missing pairs are scored by the rules",
+		},
 		&cli.IntFlag{
 			Name:     "ecn",
 			Required: false,
@@ -82,6 +108,72 @@ var createCmd = &cli.Command{
 			Value:    0.1,
 			Usage:    "specify the remote access ratio limit [0.0-1.0]",
 		},
+		&cli.Float64Flag{
+			Name:     "maxshare",
+			Required: false,
+			Value:    0.0,
+			Usage:    "specify the max ratio of the bandwidth of a view from a single node [0.0-1.0], 0.0 is unlimited",
+		},
+		&cli.Float64Flag{
+			Name:     "maxdomainshare",
+			Required: false,
+			Value:    0.0,
+			Usage:    "specify the max ratio of the bandwidth of a view from a single failure domain [0.0-1.0], 0.0 is unlimited",
+		},
+		&cli.IntFlag{
+			Name:     "mindomains",
+			Required: false,
+			Value:    0,
+			Usage:    "specify the min number of failure domains of a view",
+		},
+		&cli.Float64Flag{
+			Name:     "sticky",
+			Required: false,
+			Value:    20.0,
+			Usage:    "specify the score reduction of the previous assignments, used with --prev",
+		},
+		&cli.Float64Flag{
+			Name:     "minbw",
+			Required: false,
+			Value:    0.0,
+			Usage:    "specify the minimum bandwidth of a node in a view [Gbps]",
+		},
+		&cli.Float64Flag{
+			Name:     "bwstep",
+			Required: false,
+			Value:    0.0,
+			Usage:    "specify the granularity of the bandwidth of a node in a view [Gbps]",
+		},
+		&cli.Int64Flag{
+			Name:     "seed",
+			Required: false,
+			Value:    0,
+			Usage:    "shuffle the nodes with the same score by the seed to spread the load, unset is no shuffle",
+		},
+		&cli.BoolFlag{
+			Name:     "largestremainder",
+			Required: false,
+			Value:    false,
+			Usage:    "divide the bandwidth of a view over the nodes in exact proportion to the priorities",
+		},
+		&cli.Float64Flag{
+			Name:     "survive",
+			Required: false,
+			Value:    0.0,
+			Usage:    "specify the ratio of the bandwidth a view must keep after losing any one node [0.0-1.0], 0.0 is disabled",
+		},
+		&cli.BoolFlag{
+			Name:     "survivedomain",
+			Required: false,
+			Value:    false,
+			Usage:    "survive the loss of any one failure domain instead of node, used with --survive",
+		},
+		&cli.StringFlag{
+			Name:     "fairness",
+			Required: false,
+			Value:    "",
+			Usage:    "specify how the shortage is spread when nodes are short [maxmin, proportional]",
+		},
 		&cli.BoolFlag{
 			Name:     "dist",
 			Required: false,
@@ -94,12 +186,30 @@ var createCmd = &cli.Command{
 			Value:    false,
 			Usage:    "allocate storage not bandwidth",
 		},
+		&cli.BoolFlag{
+			Name:     "storagedemand",
+			Required: false,
+			Value:    false,
+			Usage:    "allocate the storage of the views within the storage of the nodes too",
+		},
 		&cli.BoolFlag{
 			Name:     "exclusive",
 			Required: false,
 			Value:    false,
 			Usage:    "allocate exclusively",
 		},
+		&cli.BoolFlag{
+			Name:     "opt",
+			Required: false,
+			Value:    false,
+			Usage:    "allocate optimally (min-cost)",
+		},
+		&cli.DurationFlag{
+			Name:     "timeout",
+			Required: false,
+			Value:    0,
+			Usage:    "specify the time limit of matching, write the partial rings when exceeded",
+		},
 		&cli.BoolFlag{
 			Name:     "vv",
 			Required: false,
@@ -108,37 +218,78 @@ var createCmd = &cli.Command{
 		},
 	},
 	Action: func(ctx *cli.Context) error {
-		var (
-			bw            = ctx.Float64("bw")
-			scale         = ctx.Float64("scale")
-			nodeFile      = ctx.String("node")
-			viewFile      = ctx.String("view")
-			ringFile      = ctx.String("ring")
-			ecn           = ctx.Int("ecn")
-			ras           = float32(ctx.Float64("ras"))
-			rjs           = float32(ctx.Float64("rjs"))
-			ral           = float32(ctx.Float64("ral"))
-			distMode      = ctx.Bool("dist")
-			storageMode   = ctx.Bool("storage")
-			exclusiveMode = ctx.Bool("exclusive")
-			verbose       = ctx.Bool("vv")
-		)
-		if bw <= 0 {
+		o := &createOption{
+			Total:       ctx.Float64("bw"),
+			Scale:       ctx.Float64("scale"),
+			NodeFile:    ctx.String("node"),
+			ViewFile:    ctx.String("view"),
+			RingFile:    ctx.String("ring"),
+			PrevFile:    ctx.String("prev"),
+			IPDBFile:    ctx.String("ipdb"),
+			RulesFile:   ctx.String("rules"),
+			LatencyFile: ctx.String("latency"),
+			View: bw.ViewOption{
+				EnoughNodeCount:   ctx.Int("ecn"),
+				RemoteAccessScore: float32(ctx.Float64("ras")),
+				RejectScore:       float32(ctx.Float64("rjs")),
+				RemoteAccessLimit: float32(ctx.Float64("ral")),
+				ExclusiveMode:     ctx.Bool("exclusive"),
+				MaxNodeShare:      float32(ctx.Float64("maxshare")),
+				MaxDomainShare:    float32(ctx.Float64("maxdomainshare")),
+				MinDomains:        ctx.Int("mindomains"),
+				Survivability:     float32(ctx.Float64("survive")),
+				SurviveDomain:     ctx.Bool("survivedomain"),
+				Stickiness:        float32(ctx.Float64("sticky")),
+				Fairness:          ctx.String("fairness"),
+				MinBandwidth:      ctx.Float64("minbw"),
+				BandwidthStep:     ctx.Float64("bwstep"),
+				LargestRemainder:  ctx.Bool("largestremainder"),
+			},
+			DistMode:      ctx.Bool("dist"),
+			StorageMode:   ctx.Bool("storage"),
+			StorageDemand: ctx.Bool("storagedemand"),
+			Optimal:       ctx.Bool("opt"),
+			Verbose:       ctx.Bool("vv"),
+			Timeout:       ctx.Duration("timeout"),
+		}
+		vo := &o.View
+		if o.Total <= 0 {
 			return errors.New("invalid bw")
 		}
-		if !(ras >= 20.0 && ras <= 80.0) {
+		if !(vo.RemoteAccessScore >= 20.0 && vo.RemoteAccessScore <= 80.0) {
 			return errors.New("invalid ras")
 		}
-		if !(rjs >= ras && rjs <= 100.0) {
+		if !(vo.RejectScore >= vo.RemoteAccessScore && vo.RejectScore <= 100.0) {
 			return errors.New("invalid rjs")
 		}
-		if !(ral >= 0.0 && ral <= 1.0) {
+		if !(vo.RemoteAccessLimit >= 0.0 && vo.RemoteAccessLimit <= 1.0) {
 			return errors.New("invalid ral")
 		}
-		return doCreate(
-			ctx.Context, bw, scale,
-			nodeFile, viewFile, ringFile,
-			ecn, ras, rjs, ral,
-			distMode, storageMode, exclusiveMode, verbose)
+		if !(vo.MaxNodeShare >= 0.0 && vo.MaxNodeShare <= 1.0) {
+			return errors.New("invalid maxshare")
+		}
+		if !(vo.MaxDomainShare >= 0.0 && vo.MaxDomainShare <= 1.0) {
+			return errors.New("invalid maxdomainshare")
+		}
+		if vo.MinDomains < 0 {
+			return errors.New("invalid mindomains")
+		}
+		if vo.Stickiness < 0 {
+			return errors.New("invalid sticky")
+		}
+		if vo.MinBandwidth < 0 || vo.BandwidthStep < 0 {
+			return errors.New("invalid minbw or bwstep")
+		}
+		if !(vo.Survivability >= 0.0 && vo.Survivability <= 1.0) {
+			return errors.New("invalid survive")
+		}
+		if ctx.IsSet("seed") {
+			v := ctx.Int64("seed")
+			vo.Seed = &v
+		}
+		if !(vo.Fairness == "" || vo.Fairness == "maxmin" || vo.Fairness == "proportional") {
+			return errors.New("invalid fairness")
+		}
+		return doCreate(ctx.Context, o)
 	},
 }
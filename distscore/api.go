@@ -4,9 +4,12 @@
 
 package distscore
 
+import "net"
+
 type Location struct {
 	ISP      string
 	Province string
+	City     string // can be empty
 }
 
 type LocationUnifier interface {
@@ -18,3 +21,8 @@ type LocationUnifier interface {
 type DistScorer interface {
 	DistScore(client, server Location) (score float32, local bool)
 }
+
+// LocationResolver resolves the location of an IP address.
+type LocationResolver interface {
+	Resolve(ip net.IP) (l Location, ok bool)
+}
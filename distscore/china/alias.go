@@ -106,9 +106,25 @@ func UnifyLocation(l Location, server bool, proxyMunici bool) Location {
 	if o, ok := municiProxy[l.Province]; proxyMunici && ok {
 		l.Province = o
 	}
+	l.City = unifyCity(l.City)
 	return l
 }
 
+// unifyCity trims the suffix "市" or the word "city", e.g. "广州市" and "Guangzhou City"
+// are "广州" and "guangzhou", but "Velocity" is "velocity".
+func unifyCity(city string) string {
+	city = strings.TrimSpace(city)
+	if isASCII(city) {
+		city = strings.ToLower(city)
+		city = strings.TrimSpace(strings.TrimSuffix(city, " city"))
+		return city
+	}
+	if c := strings.TrimSuffix(city, "市"); utf8.RuneCountInString(c) >= 2 {
+		city = c
+	}
+	return city
+}
+
 func InNormal(l Location) bool {
 	return normalMap[UnifyLocation(l, false, false).Province]
 }
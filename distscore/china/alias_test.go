@@ -342,3 +342,30 @@ func TestLocationUnifier_Unify(t *testing.T) {
 		})
 	}
 }
+
+func TestUnifyLocation_City(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"Chinese", "广州", "广州"},
+		{"Chinese_Suffix", "广州市", "广州"},
+		{"Chinese_Short", "沙市", "沙市"},
+		{"English", "Guangzhou", "guangzhou"},
+		{"English_Suffix", "Guangzhou City", "guangzhou"},
+		{"English_Word", "Velocity", "velocity"},
+		{"English_Only", "City", "city"},
+		{"Empty", "", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := Location{ISP: "电信", Province: "广东", City: tc.input}
+			got := UnifyLocation(loc, false, true)
+			if got.City != tc.want {
+				t.Errorf("UnifyLocation(%+v).City = %q, want %q", loc, got.City, tc.want)
+			}
+		})
+	}
+}
@@ -112,6 +112,7 @@ func init() {
 
 // DistScore rules:
 //
+//	ISP_City: 5
 //	ISP_Province: 10
 //	ISP_Region: 20
 //	ISP_AdjacentRegion: 30
@@ -121,6 +122,9 @@ func init() {
 //	ISP: 70
 //	Province_Normal: 60
 //	Other: 80
+//
+// The cities are compared only when both are set, so the locations without city are
+// scored by province.
 func DistScore(client, server Location) (score float32, local bool) {
 	c, s := client, server
 	cR, sR := regionMap[c.Province], regionMap[s.Province]
@@ -128,6 +132,11 @@ func DistScore(client, server Location) (score float32, local bool) {
 
 	if c.ISP == s.ISP {
 		if c.Province == s.Province {
+			if c.City != "" && c.City == s.City {
+				score = 5.0
+				local = true
+				return
+			}
 			score = 10.0
 			local = true
 			return
@@ -226,3 +226,64 @@ func TestDistScore_AllProvinces(t *testing.T) {
 		})
 	}
 }
+
+func TestDistScore_City(t *testing.T) {
+	cases := []struct {
+		name      string
+		client    Location
+		server    Location
+		wantScore float32
+		wantLocal bool
+	}{
+		// 相同 ISP 和城市
+		{
+			name:      "ISP_City",
+			client:    Location{ISP: "电信", Province: "广东", City: "广州"},
+			server:    Location{ISP: "电信", Province: "广东", City: "广州"},
+			wantScore: 5.0,
+			wantLocal: true,
+		},
+		// 相同省份的不同城市
+		{
+			name:      "ISP_OtherCity",
+			client:    Location{ISP: "电信", Province: "广东", City: "广州"},
+			server:    Location{ISP: "电信", Province: "广东", City: "汕头"},
+			wantScore: 10.0,
+			wantLocal: true,
+		},
+		// 只有一方有城市时按省份计算
+		{
+			name:      "ISP_NoCity",
+			client:    Location{ISP: "电信", Province: "广东", City: "广州"},
+			server:    Location{ISP: "电信", Province: "广东"},
+			wantScore: 10.0,
+			wantLocal: true,
+		},
+		// 不同 ISP 的相同城市
+		{
+			name:      "OtherISP_City",
+			client:    Location{ISP: "联通", Province: "广东", City: "广州"},
+			server:    Location{ISP: "电信", Province: "广东", City: "广州"},
+			wantScore: 60.0,
+			wantLocal: false,
+		},
+		// 不同省份的同名城市不算相同城市
+		{
+			name:      "ISP_SameCityName",
+			client:    Location{ISP: "电信", Province: "吉林", City: "吉林"},
+			server:    Location{ISP: "电信", Province: "辽宁", City: "吉林"},
+			wantScore: 20.0,
+			wantLocal: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			score, local := DistScore(tc.client, tc.server)
+			if score != tc.wantScore || local != tc.wantLocal {
+				t.Errorf("DistScore(%+v, %+v) = (%f, %v), want (%f, %v)",
+					tc.client, tc.server, score, local, tc.wantScore, tc.wantLocal)
+			}
+		})
+	}
+}
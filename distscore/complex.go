@@ -30,11 +30,23 @@ func NewComplexUnifier(orig LocationUnifier, records []UnifyRecord) LocationUnif
 	}
 }
 
+// Unify uses the record of the location, or the record of its province (without
+// city), the city is kept when the province is not changed.
 func (u *complexUnifier) Unify(l Location, server bool) Location {
 	key := UnifyKey{Source: l, Server: server}
 	if val, ok := u.recs[key]; ok {
 		return val.Target
 	}
+	if l.City != "" {
+		key.Source.City = ""
+		if val, ok := u.recs[key]; ok {
+			target := val.Target
+			if target.City == "" && target.Province == l.Province {
+				target.City = l.City
+			}
+			return target
+		}
+	}
 	return u.orig.Unify(l, server)
 }
 
@@ -73,10 +85,18 @@ func NewComplexScorer(orig DistScorer, records []ScoreRecord) DistScorer {
 	}
 }
 
+// DistScore uses the record of the locations, or the record of their provinces
+// (without city).
 func (s *complexScorer) DistScore(client, server Location) (score float32, local bool) {
 	key := ScoreKey{Client: client, Server: server}
 	if val, ok := s.recs[key]; ok {
 		return val.Score, val.Local
 	}
+	if client.City != "" || server.City != "" {
+		key.Client.City, key.Server.City = "", ""
+		if val, ok := s.recs[key]; ok {
+			return val.Score, val.Local
+		}
+	}
 	return s.orig.DistScore(client, server)
 }
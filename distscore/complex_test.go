@@ -406,3 +406,76 @@ func TestComplexUnifier_KeyOrder(t *testing.T) {
 		t.Errorf("Unify(%+v, server=false) = %+v, want %+v", loc, got2, want2)
 	}
 }
+
+func TestComplexUnifier_City(t *testing.T) {
+	records := []distscore.UnifyRecord{
+		{
+			UnifyKey: distscore.UnifyKey{Source: distscore.Location{ISP: "电信", Province: "广东"}},
+			UnifyVal: distscore.UnifyVal{Target: distscore.Location{ISP: "联通", Province: "广东"}},
+		},
+		{
+			UnifyKey: distscore.UnifyKey{Source: distscore.Location{ISP: "电信", Province: "香港"}},
+			UnifyVal: distscore.UnifyVal{Target: distscore.Location{ISP: "电信", Province: "广东"}},
+		},
+		{
+			UnifyKey: distscore.UnifyKey{Source: distscore.Location{ISP: "电信", Province: "广东", City: "汕头"}},
+			UnifyVal: distscore.UnifyVal{Target: distscore.Location{ISP: "电信", Province: "广东", City: "广州"}},
+		},
+	}
+	unifier := distscore.NewComplexUnifier(mockUnifier{}, records)
+
+	cases := []struct {
+		name string
+		loc  distscore.Location
+		want distscore.Location
+	}{
+		// 城市记录优先
+		{"CityRecord", distscore.Location{ISP: "电信", Province: "广东", City: "汕头"},
+			distscore.Location{ISP: "电信", Province: "广东", City: "广州"}},
+		// 省份记录保留城市
+		{"ProvinceRecord", distscore.Location{ISP: "电信", Province: "广东", City: "深圳"},
+			distscore.Location{ISP: "联通", Province: "广东", City: "深圳"}},
+		// 省份改变时丢弃城市
+		{"ProvinceChanged", distscore.Location{ISP: "电信", Province: "香港", City: "香港"},
+			distscore.Location{ISP: "电信", Province: "广东"}},
+		// 无记录时委托
+		{"Delegation", distscore.Location{ISP: "移动", Province: "广东", City: "深圳"},
+			distscore.Location{ISP: "移动", Province: "广东", City: "深圳"}},
+	}
+	for _, tc := range cases {
+		if got := unifier.Unify(tc.loc, false); got != tc.want {
+			t.Errorf("%s: Unify(%+v) = %+v, want %+v", tc.name, tc.loc, got, tc.want)
+		}
+	}
+}
+
+func TestComplexScorer_City(t *testing.T) {
+	records := []distscore.ScoreRecord{
+		{
+			ScoreKey: distscore.ScoreKey{
+				Client: distscore.Location{ISP: "电信", Province: "广东"},
+				Server: distscore.Location{ISP: "电信", Province: "湖南"},
+			},
+			ScoreVal: distscore.ScoreVal{Score: 15.0},
+		},
+		{
+			ScoreKey: distscore.ScoreKey{
+				Client: distscore.Location{ISP: "电信", Province: "广东", City: "广州"},
+				Server: distscore.Location{ISP: "电信", Province: "湖南", City: "长沙"},
+			},
+			ScoreVal: distscore.ScoreVal{Score: 12.0},
+		},
+	}
+	scorer := distscore.NewComplexScorer(mockScorer{}, records)
+
+	client := distscore.Location{ISP: "电信", Province: "广东", City: "广州"}
+	if score, _ := scorer.DistScore(client, distscore.Location{ISP: "电信", Province: "湖南", City: "长沙"}); score != 12.0 {
+		t.Errorf("Expected the city record, got %f", score)
+	}
+	if score, _ := scorer.DistScore(client, distscore.Location{ISP: "电信", Province: "湖南", City: "衡阳"}); score != 15.0 {
+		t.Errorf("Expected the province record, got %f", score)
+	}
+	if score, _ := scorer.DistScore(client, distscore.Location{ISP: "电信", Province: "江西", City: "南昌"}); score != 50.0 {
+		t.Errorf("Expected delegation, got %f", score)
+	}
+}
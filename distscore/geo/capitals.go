@@ -0,0 +1,44 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geo
+
+// ProvinceCapitals are the coordinates of the capitals of the provinces of China, by
+// the province names used by china.DistScore.
+var ProvinceCapitals = map[string]Coord{
+	"北京":  {39.9042, 116.4074},
+	"天津":  {39.3434, 117.3616},
+	"河北":  {38.0428, 114.5149}, // 石家庄
+	"山西":  {37.8706, 112.5489}, // 太原
+	"内蒙古": {40.8424, 111.7490}, // 呼和浩特
+	"辽宁":  {41.8057, 123.4315}, // 沈阳
+	"吉林":  {43.8171, 125.3235}, // 长春
+	"黑龙江": {45.8038, 126.5350}, // 哈尔滨
+	"上海":  {31.2304, 121.4737},
+	"江苏":  {32.0603, 118.7969}, // 南京
+	"浙江":  {30.2741, 120.1551}, // 杭州
+	"安徽":  {31.8206, 117.2272}, // 合肥
+	"福建":  {26.0745, 119.2965}, // 福州
+	"江西":  {28.6820, 115.8579}, // 南昌
+	"山东":  {36.6512, 117.1201}, // 济南
+	"河南":  {34.7466, 113.6254}, // 郑州
+	"湖北":  {30.5928, 114.3055}, // 武汉
+	"湖南":  {28.2282, 112.9388}, // 长沙
+	"广东":  {23.1291, 113.2644}, // 广州
+	"广西":  {22.8170, 108.3669}, // 南宁
+	"海南":  {20.0440, 110.1999}, // 海口
+	"重庆":  {29.5630, 106.5516},
+	"四川":  {30.5728, 104.0668}, // 成都
+	"贵州":  {26.6470, 106.6302}, // 贵阳
+	"云南":  {25.0389, 102.7183}, // 昆明
+	"西藏":  {29.6520, 91.1721},  // 拉萨
+	"陕西":  {34.3416, 108.9398}, // 西安
+	"甘肃":  {36.0611, 103.8343}, // 兰州
+	"青海":  {36.6171, 101.7782}, // 西宁
+	"宁夏":  {38.4872, 106.2309}, // 银川
+	"新疆":  {43.8256, 87.6168},  // 乌鲁木齐
+	"台湾":  {25.0330, 121.5654}, // 台北
+	"香港":  {22.3193, 114.1694},
+	"澳门":  {22.1987, 113.5439},
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package geo scores the distance by the coordinates of the locations.
+package geo
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+
+	. "github.com/someonegg/rsdmatch/distscore"
+)
+
+// Coord is a geographic coordinate in degrees.
+type Coord struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// The mean radius of the earth in km.
+const earthRadius = 6371.0
+
+// Distance returns the great-circle distance (km) between a and b by the haversine
+// formula.
+func Distance(a, b Coord) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// ReadCoords reads the coordinates by location (Location.City or Province) in JSON, e.g.
+//
+//	{"北京": {"lat": 39.9042, "lon": 116.4074}}
+func ReadCoords(r io.Reader) (map[string]Coord, error) {
+	var coords map[string]Coord
+	if err := json.NewDecoder(r).Decode(&coords); err != nil {
+		return nil, err
+	}
+	return coords, nil
+}
+
+type Option struct {
+	Near  float32 `json:"near"`  // the score at 0 km.
+	Far   float32 `json:"far"`   // the score at Range and beyond.
+	Range float64 `json:"range"` // km, the score grows linearly from Near to Far in it.
+
+	ISPPenalty float32 `json:"isp_penalty"` // added to the score when the ISPs differ.
+	Unknown    float32 `json:"unknown"`     // the score when a coordinate is unknown.
+}
+
+// DefaultOption is in the score space of china.DistScore, e.g. 10.0 for the same
+// province, 60.0 for the same province of another ISP, and 80.0 for the unknown.
+var DefaultOption = &Option{
+	Near:       10.0,
+	Far:        70.0,
+	Range:      3000.0,
+	ISPPenalty: 50.0,
+	Unknown:    80.0,
+}
+
+type distScorer struct {
+	coords map[string]Coord
+	o      Option
+}
+
+// NewDistScorer creates a scorer by the coordinates of the locations, by Location.City
+// when found, otherwise by Location.Province. Use DefaultOption when o is nil, otherwise
+// all the fields of o are used, e.g. a zero ISPPenalty means no penalty, except Range
+// which uses DefaultOption.Range when <= 0. Copy DefaultOption to change a few fields.
+//
+// The score is Near + (Far - Near) × distance / Range, at most Far, plus ISPPenalty
+// when the ISPs differ, at most 100.0. The client and server are local when they have
+// the same ISP and province.
+func NewDistScorer(coords map[string]Coord, o *Option) DistScorer {
+	if o == nil {
+		o = DefaultOption
+	}
+	s := distScorer{coords: coords, o: *o}
+	if s.o.Range <= 0 {
+		s.o.Range = DefaultOption.Range
+	}
+	return s
+}
+
+func (s distScorer) DistScore(client, server Location) (score float32, local bool) {
+	local = client.ISP == server.ISP && client.Province == server.Province
+
+	c, cok := s.coord(client)
+	v, sok := s.coord(server)
+	if !cok || !sok {
+		if local {
+			return s.o.Near, true
+		}
+		return s.o.Unknown, false
+	}
+
+	ratio := math.Min(Distance(c, v)/s.o.Range, 1)
+	score = s.o.Near + (s.o.Far-s.o.Near)*float32(ratio)
+	if client.ISP != server.ISP {
+		score += s.o.ISPPenalty
+	}
+	if score > 100.0 {
+		score = 100.0
+	}
+	return
+}
+
+func (s distScorer) coord(l Location) (Coord, bool) {
+	if c, ok := s.coords[l.City]; ok && l.City != "" {
+		return c, true
+	}
+	c, ok := s.coords[l.Province]
+	return c, ok
+}
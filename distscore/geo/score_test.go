@@ -0,0 +1,101 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geo
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	. "github.com/someonegg/rsdmatch/distscore"
+)
+
+func TestDistance(t *testing.T) {
+	// 北京到上海约 1067 公里
+	d := Distance(ProvinceCapitals["北京"], ProvinceCapitals["上海"])
+	if math.Abs(d-1067) > 10 {
+		t.Errorf("Expected about 1067km, got %f", d)
+	}
+
+	if d := Distance(ProvinceCapitals["北京"], ProvinceCapitals["北京"]); d != 0 {
+		t.Errorf("Expected 0km, got %f", d)
+	}
+
+	// 对跖点
+	if d := Distance(Coord{0, 0}, Coord{0, 180}); math.Abs(d-math.Pi*earthRadius) > 1e-6 {
+		t.Errorf("Expected half the circumference, got %f", d)
+	}
+}
+
+func TestDistScore(t *testing.T) {
+	s := NewDistScorer(ProvinceCapitals, nil)
+
+	cases := []struct {
+		name      string
+		client    Location
+		server    Location
+		wantMin   float32
+		wantMax   float32
+		wantLocal bool
+	}{
+		{"SameProvince", Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "北京"}, 10.0, 10.0, true},
+		{"Near", Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "天津"}, 10.0, 13.0, false},
+		{"Middle", Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "上海"}, 30.0, 32.0, false},
+		{"Far", Location{ISP: "电信", Province: "黑龙江"}, Location{ISP: "电信", Province: "西藏"}, 70.0, 70.0, false},
+		{"OtherISP", Location{ISP: "联通", Province: "北京"}, Location{ISP: "电信", Province: "北京"}, 60.0, 60.0, false},
+		{"OtherISPFar", Location{ISP: "联通", Province: "黑龙江"}, Location{ISP: "电信", Province: "西藏"}, 100.0, 100.0, false},
+		{"Unknown", Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "火星"}, 80.0, 80.0, false},
+		{"UnknownLocal", Location{ISP: "电信", Province: "火星"}, Location{ISP: "电信", Province: "火星"}, 10.0, 10.0, true},
+	}
+	for _, c := range cases {
+		score, local := s.DistScore(c.client, c.server)
+		if score < c.wantMin || score > c.wantMax || local != c.wantLocal {
+			t.Errorf("%s: expected score [%v, %v] and local %v, got %v and %v",
+				c.name, c.wantMin, c.wantMax, c.wantLocal, score, local)
+		}
+	}
+}
+
+func TestDistScore_Option(t *testing.T) {
+	// 复制默认选项后修改部分字段
+	o := *DefaultOption
+	o.Range, o.ISPPenalty = 1000.0, 20.0
+	s := NewDistScorer(ProvinceCapitals, &o)
+	if score, _ := s.DistScore(Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "上海"}); score != 70.0 {
+		t.Errorf("Expected the far score beyond range, got %v", score)
+	}
+	if score, _ := s.DistScore(Location{ISP: "联通", Province: "北京"}, Location{ISP: "电信", Province: "北京"}); score != 30.0 {
+		t.Errorf("Expected the near score with the penalty, got %v", score)
+	}
+	if score, _ := s.DistScore(Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "火星"}); score != 80.0 {
+		t.Errorf("Expected the default unknown score, got %v", score)
+	}
+
+	// 零值的 Near 和 ISPPenalty 按原样使用，Range 为零时使用默认值
+	s = NewDistScorer(ProvinceCapitals, &Option{Far: 60.0, Unknown: 80.0})
+	if score, local := s.DistScore(Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "北京"}); score != 0.0 || !local {
+		t.Errorf("Expected the zero near score and local, got %v and %v", score, local)
+	}
+	if score, _ := s.DistScore(Location{ISP: "联通", Province: "北京"}, Location{ISP: "电信", Province: "北京"}); score != 0.0 {
+		t.Errorf("Expected no ISP penalty, got %v", score)
+	}
+	if score, _ := s.DistScore(Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "新疆"}); score <= 0.0 || score >= 60.0 {
+		t.Errorf("Expected a score within the default range, got %v", score)
+	}
+}
+
+func TestReadCoords(t *testing.T) {
+	coords, err := ReadCoords(strings.NewReader(`{"dc1": {"lat": 1.5, "lon": 2.5}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c, ok := coords["dc1"]; !ok || c.Lat != 1.5 || c.Lon != 2.5 {
+		t.Errorf("Expected dc1 at (1.5, 2.5), got %v", coords)
+	}
+
+	if _, err := ReadCoords(strings.NewReader(`[1, 2]`)); err == nil {
+		t.Errorf("Expected error for invalid input")
+	}
+}
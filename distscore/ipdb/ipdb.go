@@ -0,0 +1,151 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ipdb resolves the locations of IP addresses by a CIDR table.
+package ipdb
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	. "github.com/someonegg/rsdmatch/distscore"
+)
+
+// DB is a CIDR table of IPv4 and IPv6, it resolves an address by the longest prefix
+// matched. It is not safe to Add concurrently with Resolve.
+type DB struct {
+	v4 table
+	v6 table
+}
+
+type table struct {
+	bits    int
+	lengths []int // the prefix lengths present, descending
+	entries map[int]map[string]Location
+}
+
+// New creates an empty DB.
+func New() *DB {
+	return &DB{
+		v4: table{bits: 8 * net.IPv4len},
+		v6: table{bits: 8 * net.IPv6len},
+	}
+}
+
+// Add adds the prefix, a later one replaces the same prefix.
+func (db *DB) Add(prefix *net.IPNet, l Location) {
+	ones, bits := prefix.Mask.Size()
+	ip := prefix.IP
+	if ip4 := ip.To4(); ip4 != nil && bits == 8*net.IPv4len {
+		db.v4.add(ip4, ones, l)
+		return
+	}
+	if bits == 8*net.IPv6len {
+		db.v6.add(ip.To16(), ones, l)
+	}
+}
+
+// Resolve returns the location of the longest prefix containing ip.
+func (db *DB) Resolve(ip net.IP) (l Location, ok bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return db.v4.resolve(ip4)
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return db.v6.resolve(ip16)
+	}
+	return
+}
+
+// Len returns the number of the prefixes.
+func (db *DB) Len() int {
+	n := 0
+	for _, t := range []*table{&db.v4, &db.v6} {
+		for _, entries := range t.entries {
+			n += len(entries)
+		}
+	}
+	return n
+}
+
+func (t *table) add(ip net.IP, ones int, l Location) {
+	if t.entries == nil {
+		t.entries = make(map[int]map[string]Location)
+	}
+	entries, ok := t.entries[ones]
+	if !ok {
+		entries = make(map[string]Location)
+		t.entries[ones] = entries
+		t.lengths = append(t.lengths, ones)
+		sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+	}
+	entries[string(ip.Mask(net.CIDRMask(ones, t.bits)))] = l
+}
+
+func (t *table) resolve(ip net.IP) (l Location, ok bool) {
+	for _, ones := range t.lengths {
+		if l, ok = t.entries[ones][string(ip.Mask(net.CIDRMask(ones, t.bits)))]; ok {
+			return
+		}
+	}
+	return
+}
+
+// ReadCSV reads the DB in CSV, the columns are
+//
+//	prefix,isp,province[,city]
+//
+// The prefix is a CIDR, e.g. 1.2.3.0/24 or 2001:db8::/32, or an address. The first row
+// is skipped when it is the header, and the rows beginning with '#' are comments.
+func ReadCSV(r io.Reader) (*DB, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	db := New()
+	for row := 1; ; row++ {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return db, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row == 1 && fields[0] == "prefix" {
+			continue
+		}
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, fmt.Errorf("row %d: expected 3 or 4 columns, got %d", row, len(fields))
+		}
+
+		prefix, err := parsePrefix(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		l := Location{ISP: strings.TrimSpace(fields[1]), Province: strings.TrimSpace(fields[2])}
+		if len(fields) == 4 {
+			l.City = strings.TrimSpace(fields[3])
+		}
+		db.Add(prefix, l)
+	}
+}
+
+func parsePrefix(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}, nil
+	}
+	_, prefix, err := net.ParseCIDR(s)
+	return prefix, err
+}
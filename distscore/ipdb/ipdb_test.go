@@ -0,0 +1,99 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipdb
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/someonegg/rsdmatch/distscore"
+)
+
+func TestResolve(t *testing.T) {
+	data := `prefix,isp,province,city
+# 注释行
+1.0.0.0/8,电信,广东
+1.2.0.0/16,电信,广东,广州
+1.2.3.0/24,联通,北京
+1.2.3.4,移动,上海,上海
+2001:db8::/32,电信,浙江,杭州
+2001:db8:1::/48,电信,江苏
+`
+	db, err := ReadCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if db.Len() != 6 {
+		t.Errorf("Expected 6 prefixes, got %d", db.Len())
+	}
+
+	cases := []struct {
+		ip   string
+		want Location
+		ok   bool
+	}{
+		// 最长前缀匹配
+		{"1.9.9.9", Location{ISP: "电信", Province: "广东"}, true},
+		{"1.2.9.9", Location{ISP: "电信", Province: "广东", City: "广州"}, true},
+		{"1.2.3.9", Location{ISP: "联通", Province: "北京"}, true},
+		{"1.2.3.4", Location{ISP: "移动", Province: "上海", City: "上海"}, true},
+		// IPv4 映射的 IPv6 地址按 IPv4 查找
+		{"::ffff:1.2.3.9", Location{ISP: "联通", Province: "北京"}, true},
+		{"2001:db8:2::1", Location{ISP: "电信", Province: "浙江", City: "杭州"}, true},
+		{"2001:db8:1::1", Location{ISP: "电信", Province: "江苏"}, true},
+		// 未命中
+		{"2.0.0.1", Location{}, false},
+		{"2001:db9::1", Location{}, false},
+	}
+	for _, c := range cases {
+		got, ok := db.Resolve(net.ParseIP(c.ip))
+		if got != c.want || ok != c.ok {
+			t.Errorf("Resolve(%s) = %+v, %v, want %+v, %v", c.ip, got, ok, c.want, c.ok)
+		}
+	}
+
+	if _, ok := db.Resolve(nil); ok {
+		t.Errorf("Expected nil not resolved")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	db := New()
+	_, prefix, _ := net.ParseCIDR("10.0.0.0/8")
+	db.Add(prefix, Location{ISP: "a", Province: "b"})
+	db.Add(prefix, Location{ISP: "c", Province: "d"}) // 替换相同前缀
+
+	if db.Len() != 1 {
+		t.Errorf("Expected 1 prefix, got %d", db.Len())
+	}
+	if l, ok := db.Resolve(net.ParseIP("10.1.2.3")); !ok || l.ISP != "c" {
+		t.Errorf("Expected the later location, got %+v, %v", l, ok)
+	}
+
+	// 0.0.0.0/0 匹配所有 IPv4 地址
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	db.Add(all, Location{ISP: "x", Province: "y"})
+	if l, ok := db.Resolve(net.ParseIP("192.168.0.1")); !ok || l.ISP != "x" {
+		t.Errorf("Expected the default route, got %+v, %v", l, ok)
+	}
+}
+
+func TestReadCSV_Invalid(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+	}{
+		{"Columns", "1.0.0.0/8,电信\n"},
+		{"Prefix", "1.0.0.0/33,电信,广东\n"},
+		{"Address", "1.0.0,电信,广东\n"},
+		{"Quote", "\"1.0.0.0/8,电信,广东\n"},
+	}
+	for _, c := range cases {
+		if _, err := ReadCSV(strings.NewReader(c.data)); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package latency scores the distance by the measured RTT between the locations.
+package latency
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/someonegg/rsdmatch/distscore"
+)
+
+// Record is the RTT (ms) measured from the client location to the server location.
+type Record struct {
+	ClientISP      string  `json:"client_isp"`
+	ClientProvince string  `json:"client_province"`
+	ServerISP      string  `json:"server_isp"`
+	ServerProvince string  `json:"server_province"`
+	P50            float64 `json:"p50"`
+	P95            float64 `json:"p95"`
+}
+
+// ReadJSON reads the records in a JSON array.
+func ReadJSON(r io.Reader) ([]Record, error) {
+	var records []Record
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ReadCSV reads the records in CSV, the columns are
+//
+//	client_isp,client_province,server_isp,server_province,p50,p95
+//
+// The first row is skipped when it is the header.
+func ReadCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 6
+	cr.TrimLeadingSpace = true
+
+	var records []Record
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && row[4] == "p50" {
+			continue
+		}
+
+		p50, err := strconv.ParseFloat(row[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid p50: %v", line, err)
+		}
+		p95, err := strconv.ParseFloat(row[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid p95: %v", line, err)
+		}
+		records = append(records, Record{row[0], row[1], row[2], row[3], p50, p95})
+	}
+}
+
+// Point is a point of the latency-score curve.
+type Point struct {
+	RTT   float64 `json:"rtt"` // ms
+	Score float32 `json:"score"`
+}
+
+type Option struct {
+	// The score is interpolated linearly between the points (by ascending RTT), and is
+	// the score of the first or last point beyond them. Use DefaultOption.Curve when
+	// empty.
+	Curve []Point `json:"curve"`
+
+	// Score by P95 instead of P50.
+	UseP95 bool `json:"p95"`
+
+	// The client and server are local when the RTT <= Local (ms), use
+	// DefaultOption.Local when <= 0.
+	Local float64 `json:"local"`
+}
+
+// DefaultOption is in the score space of china.DistScore, e.g. 10.0 within the same
+// city and 80.0 (the default reject score) at 100ms.
+var DefaultOption = &Option{
+	Curve: []Point{
+		{0, 10.0},
+		{10, 20.0},
+		{30, 40.0},
+		{60, 60.0},
+		{100, 80.0},
+		{200, 100.0},
+	},
+	Local: 5.0,
+}
+
+type distScorer struct {
+	rtts     map[ScoreKey]float64
+	fallback DistScorer
+	curve    []Point
+	local    float64
+}
+
+// NewDistScorer creates a scorer by the latency records (by province), the later record
+// of the same pair of locations wins, the cities of the locations are ignored. The pairs
+// without record are scored by fallback, or 100.0 when fallback is nil. o can be nil.
+//
+// The locations scored are unified already, e.g. by bandwidth.Matcher.Unifier, so the
+// locations of the records must be unified by the same unifier, e.g. "中国电信" and
+// "北京市" are "电信" and "北京" by china.NewLocationUnifier. They are only trimmed
+// when unifier is nil.
+func NewDistScorer(records []Record, unifier LocationUnifier, fallback DistScorer, o *Option) DistScorer {
+	if o == nil {
+		o = DefaultOption
+	}
+	s := &distScorer{
+		rtts:     make(map[ScoreKey]float64, len(records)),
+		fallback: fallback,
+		curve:    append([]Point(nil), o.Curve...),
+		local:    o.Local,
+	}
+	if len(s.curve) == 0 {
+		s.curve = append(s.curve, DefaultOption.Curve...)
+	}
+	sort.SliceStable(s.curve, func(i, j int) bool { return s.curve[i].RTT < s.curve[j].RTT })
+	if s.local <= 0 {
+		s.local = DefaultOption.Local
+	}
+
+	for _, rec := range records {
+		key := ScoreKey{
+			Client: Location{ISP: strings.TrimSpace(rec.ClientISP), Province: strings.TrimSpace(rec.ClientProvince)},
+			Server: Location{ISP: strings.TrimSpace(rec.ServerISP), Province: strings.TrimSpace(rec.ServerProvince)},
+		}
+		if unifier != nil {
+			key.Client = unifier.Unify(key.Client, false)
+			key.Server = unifier.Unify(key.Server, true)
+		}
+		rtt := rec.P50
+		if o.UseP95 {
+			rtt = rec.P95
+		}
+		s.rtts[key] = rtt
+	}
+	return s
+}
+
+func (s *distScorer) DistScore(client, server Location) (score float32, local bool) {
+	key := ScoreKey{Client: client, Server: server}
+	key.Client.City, key.Server.City = "", ""
+	rtt, ok := s.rtts[key]
+	if !ok {
+		if s.fallback != nil {
+			return s.fallback.DistScore(client, server)
+		}
+		return 100.0, false
+	}
+	return s.score(rtt), rtt <= s.local
+}
+
+// score maps the RTT to the score by the curve.
+func (s *distScorer) score(rtt float64) float32 {
+	k := sort.Search(len(s.curve), func(k int) bool { return s.curve[k].RTT >= rtt })
+	switch {
+	case k == 0:
+		return s.curve[0].Score
+	case k == len(s.curve):
+		return s.curve[k-1].Score
+	}
+	a, b := s.curve[k-1], s.curve[k]
+	return a.Score + (b.Score-a.Score)*float32((rtt-a.RTT)/(b.RTT-a.RTT))
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package latency
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/someonegg/rsdmatch/distscore"
+	"github.com/someonegg/rsdmatch/distscore/china"
+)
+
+// mockScorer 对所有位置返回固定分数
+type mockScorer struct{}
+
+func (mockScorer) DistScore(client, server Location) (float32, bool) {
+	return 42.0, false
+}
+
+func TestReadCSV(t *testing.T) {
+	data := `client_isp,client_province,server_isp,server_province,p50,p95
+电信,北京,电信,北京,2,4
+电信, 北京, 电信, 上海, 30.5, 45
+`
+	records, err := ReadCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	want := Record{"电信", "北京", "电信", "上海", 30.5, 45}
+	if records[1] != want {
+		t.Errorf("Expected %v, got %v", want, records[1])
+	}
+
+	// 无表头
+	records, err = ReadCSV(strings.NewReader("电信,北京,电信,北京,2,4\n"))
+	if err != nil || len(records) != 1 {
+		t.Errorf("Expected 1 record without header, got %v, %v", records, err)
+	}
+
+	if _, err := ReadCSV(strings.NewReader("电信,北京,电信,北京,x,4\n")); err == nil {
+		t.Errorf("Expected error for invalid p50")
+	}
+	if _, err := ReadCSV(strings.NewReader("电信,北京,电信\n")); err == nil {
+		t.Errorf("Expected error for missing columns")
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	data := `[{"client_isp": "电信", "client_province": "北京", "server_isp": "联通", "server_province": "北京", "p50": 8, "p95": 20}]`
+	records, err := ReadJSON(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := Record{"电信", "北京", "联通", "北京", 8, 20}
+	if len(records) != 1 || records[0] != want {
+		t.Errorf("Expected [%v], got %v", want, records)
+	}
+}
+
+func TestDistScore(t *testing.T) {
+	records := []Record{
+		{"电信", "北京", "电信", "北京", 2, 4},
+		{"电信", "北京", "电信", "上海", 30, 60},
+		{"电信", "北京", "电信", "新疆", 150, 400},
+		{"电信", "北京", "联通", "北京", 20, 100},
+	}
+
+	cases := []struct {
+		name      string
+		scorer    DistScorer
+		server    Location
+		wantScore float32
+		wantLocal bool
+	}{
+		{"Local", NewDistScorer(records, nil, nil, nil), Location{ISP: "电信", Province: "北京"}, 12.0, true},
+		{"Curve", NewDistScorer(records, nil, nil, nil), Location{ISP: "电信", Province: "上海"}, 40.0, false},
+		{"Interpolate", NewDistScorer(records, nil, nil, nil), Location{ISP: "电信", Province: "新疆"}, 90.0, false},
+		{"Between", NewDistScorer(records, nil, nil, nil), Location{ISP: "联通", Province: "北京"}, 30.0, false},
+		{"Missing", NewDistScorer(records, nil, nil, nil), Location{ISP: "电信", Province: "广东"}, 100.0, false},
+		{"Fallback", NewDistScorer(records, nil, mockScorer{}, nil), Location{ISP: "电信", Province: "广东"}, 42.0, false},
+		{"P95", NewDistScorer(records, nil, nil, &Option{UseP95: true}), Location{ISP: "电信", Province: "上海"}, 60.0, false},
+		{"Beyond", NewDistScorer(records, nil, nil, &Option{UseP95: true}), Location{ISP: "电信", Province: "新疆"}, 100.0, false},
+	}
+	client := Location{ISP: "电信", Province: "北京"}
+	for _, c := range cases {
+		score, local := c.scorer.DistScore(client, c.server)
+		if score != c.wantScore || local != c.wantLocal {
+			t.Errorf("%s: expected %v and %v, got %v and %v", c.name, c.wantScore, c.wantLocal, score, local)
+		}
+	}
+}
+
+func TestDistScore_Option(t *testing.T) {
+	records := []Record{
+		{"电信", "北京", "电信", "天津", 8, 10},
+		{"电信", "北京", "电信", "天津", 4, 6}, // 后者覆盖前者
+	}
+	o := &Option{
+		Curve: []Point{{50, 50.0}, {0, 0.0}}, // 乱序的曲线会被排序
+		Local: 5.0,
+	}
+	s := NewDistScorer(records, nil, nil, o)
+	score, local := s.DistScore(Location{ISP: "电信", Province: "北京"}, Location{ISP: "电信", Province: "天津"})
+	if score != 4.0 || !local {
+		t.Errorf("Expected 4.0 and local, got %v and %v", score, local)
+	}
+	if o.Curve[0].RTT != 50 {
+		t.Errorf("Expected the option untouched, got %v", o.Curve)
+	}
+}
+
+func TestDistScore_Unifier(t *testing.T) {
+	records := []Record{
+		{"中国电信", "北京市", "telecom", "shanghai", 30, 60},
+	}
+	client := Location{ISP: "电信", Province: "北京"}
+	server := Location{ISP: "电信", Province: "上海"}
+
+	// 记录中的位置按同一个 unifier 统一后才能匹配
+	s := NewDistScorer(records, china.NewLocationUnifier(false), nil, nil)
+	if score, _ := s.DistScore(client, server); score != 40.0 {
+		t.Errorf("Expected 40.0, got %v", score)
+	}
+
+	// 代理直辖市时，北京统一为河北
+	s = NewDistScorer(records, china.NewLocationUnifier(true), nil, nil)
+	if score, _ := s.DistScore(Location{ISP: "电信", Province: "河北"}, Location{ISP: "电信", Province: "江苏"}); score != 40.0 {
+		t.Errorf("Expected 40.0 with the proxied municipalities, got %v", score)
+	}
+
+	s = NewDistScorer(records, nil, nil, nil)
+	if score, _ := s.DistScore(client, server); score != 100.0 {
+		t.Errorf("Expected 100.0 without unifier, got %v", score)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rule
+
+// ChinaRules is the rule file of china.DistScore, the scores are the same.
+const ChinaRules = `{
+  "region_sets": [
+    {
+      "regions": {
+        "dongbei": ["辽宁", "吉林", "黑龙江"],
+        "huabei": ["河北", "北京", "天津", "山西", "内蒙古"],
+        "huazhbei": ["山东", "河南"],
+        "huazhnan": ["湖北", "湖南"],
+        "huadong": ["江苏", "安徽", "浙江", "江西", "福建", "上海"],
+        "huanan": ["广东", "广西", "海南"],
+        "xibei": ["陕西", "宁夏", "甘肃", "青海"],
+        "xinan": ["四川", "云南", "贵州", "重庆"],
+        "xinjiang": ["新疆"],
+        "xizang": ["西藏"],
+        "taiwan": ["台湾"],
+        "hkmo": ["香港", "澳门"],
+        "cn": ["中国"]
+      },
+      "neighbors": {
+        "dongbei": ["huabei"],
+        "huabei": ["dongbei", "huazhbei", "xibei"],
+        "huazhbei": ["huazhnan", "huabei", "huadong", "xibei"],
+        "huazhnan": ["huazhbei", "huadong", "huanan", "xinan"],
+        "huadong": ["huazhbei", "huazhnan", "huanan"],
+        "huanan": ["huazhnan", "huadong", "xinan"],
+        "xibei": ["huazhbei", "huabei"],
+        "xinan": ["huazhnan", "huanan"]
+      }
+    },
+    {
+      "regions": {
+        "dongbei": ["辽宁", "吉林", "黑龙江"],
+        "huabei": ["河北", "北京", "天津", "山西", "内蒙古"],
+        "huazhong": ["河南", "湖北", "湖南"],
+        "huadong": ["山东", "江苏", "安徽", "浙江", "江西", "福建", "上海"],
+        "huanan": ["广东", "广西", "海南"],
+        "xibei": ["陕西", "宁夏", "甘肃", "青海"],
+        "xinan": ["四川", "云南", "贵州", "重庆"],
+        "xinjiang": ["新疆"],
+        "xizang": ["西藏"],
+        "taiwan": ["台湾"],
+        "hkmo": ["香港", "澳门"],
+        "cn": ["中国"]
+      }
+    }
+  ],
+  "classes": {
+    "central": ["北京", "天津", "河北", "山西", "山东", "河南", "湖北", "湖南",
+      "江苏", "安徽", "浙江", "江西", "福建", "上海", "广东", "广西", "中国"],
+    "normal": ["北京", "天津", "河北", "山西", "山东", "河南", "湖北", "湖南",
+      "江苏", "安徽", "浙江", "江西", "福建", "上海", "广东", "广西", "中国",
+      "辽宁", "陕西", "四川", "重庆", "贵州"],
+    "frontier": ["新疆", "西藏"]
+  },
+  "rules": [
+    {"same_isp": true, "same_city": true, "score": 5, "local": true},
+    {"same_isp": true, "same_province": true, "score": 10, "local": true},
+    {"same_isp": true, "same_region": true, "score": 20},
+    {"same_isp": true, "server_class": "normal", "neighbor_region": true, "score": 30},
+    {"same_isp": true, "client_class": "central", "server_class": "central", "score": 40},
+    {"same_isp": true, "server_class": "normal", "score": 50},
+    {"same_isp": true, "server_class": "!frontier", "score": 60},
+    {"same_isp": true, "score": 70},
+    {"server_class": "normal", "same_province": true, "score": 60}
+  ],
+  "default": 80
+}
+`
@@ -0,0 +1,234 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rule scores the distance by the ordered rules of a rule file, see
+// ChinaRules for an example.
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	. "github.com/someonegg/rsdmatch/distscore"
+	"gopkg.in/yaml.v3"
+)
+
+// Rules is the rule file in JSON, or in YAML with the same field names.
+type Rules struct {
+	// The provinces are grouped into regions by each region set, two provinces are in
+	// the same region when they are in any set. The provinces not in a set are in the
+	// same unnamed region of it.
+	RegionSets []RegionSet `json:"region_sets"`
+
+	// The named classes of the provinces, e.g. "central".
+	Classes map[string][]string `json:"classes"`
+
+	// The first rule matched gives the score.
+	Rules []Rule `json:"rules"`
+
+	// The score when no rule is matched.
+	Default float32 `json:"default"`
+}
+
+type RegionSet struct {
+	Regions   map[string][]string `json:"regions"`   // the provinces by region name
+	Neighbors map[string][]string `json:"neighbors"` // the neighbor regions by region name
+}
+
+// Rule matches when all its predicates hold, the unset ones always hold.
+type Rule struct {
+	SameISP        *bool `json:"same_isp,omitempty"`
+	SameProvince   *bool `json:"same_province,omitempty"`
+	SameCity       *bool `json:"same_city,omitempty"` // both cities are set and equal, in the same province.
+	SameRegion     *bool `json:"same_region,omitempty"`
+	NeighborRegion *bool `json:"neighbor_region,omitempty"` // the server is in a neighbor region of the client's.
+
+	// The class of the province of the client or server, "!class" means not in class.
+	ClientClass string `json:"client_class,omitempty"`
+	ServerClass string `json:"server_class,omitempty"`
+
+	Score float32 `json:"score"`
+	Local bool    `json:"local,omitempty"`
+}
+
+// ReadRules reads the rules in JSON, the unknown fields are rejected.
+func ReadRules(r io.Reader) (*Rules, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var rules Rules
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, err
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// ReadYAMLRules reads the rules in YAML, the field names are the same as in JSON, and
+// the unknown fields are rejected too.
+func ReadYAMLRules(r io.Reader) (*Rules, error) {
+	var v interface{}
+	if err := yaml.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadRules(bytes.NewReader(data))
+}
+
+// DefaultRules returns the rules of ChinaRules.
+func DefaultRules() *Rules {
+	rules, err := ReadRules(strings.NewReader(ChinaRules))
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// Validate checks the scores are in [0.0-100.0], and the regions and classes referred
+// are defined.
+func (rs *Rules) Validate() error {
+	for k, set := range rs.RegionSets {
+		for region, neighbors := range set.Neighbors {
+			if _, ok := set.Regions[region]; !ok {
+				return fmt.Errorf("region set %d: unknown region %q", k, region)
+			}
+			for _, neighbor := range neighbors {
+				if _, ok := set.Regions[neighbor]; !ok {
+					return fmt.Errorf("region set %d: unknown neighbor %q of %q", k, neighbor, region)
+				}
+			}
+		}
+	}
+
+	for k, rule := range rs.Rules {
+		for _, class := range []string{rule.ClientClass, rule.ServerClass} {
+			class = strings.TrimPrefix(class, "!")
+			if _, ok := rs.Classes[class]; class != "" && !ok {
+				return fmt.Errorf("rule %d: unknown class %q", k, class)
+			}
+		}
+		if !(rule.Score >= 0.0 && rule.Score <= 100.0) {
+			return fmt.Errorf("rule %d: invalid score %v", k, rule.Score)
+		}
+	}
+	if !(rs.Default >= 0.0 && rs.Default <= 100.0) {
+		return fmt.Errorf("invalid default score %v", rs.Default)
+	}
+	return nil
+}
+
+type regionSet struct {
+	regions   map[string]string          // the region by province
+	neighbors map[string]map[string]bool // the neighbor regions by region
+}
+
+type distScorer struct {
+	sets         []regionSet
+	classes      map[string]map[string]bool
+	rules        []Rule
+	defaultScore float32
+}
+
+// NewDistScorer creates a scorer by the rules, see Rules.Validate for the error.
+func NewDistScorer(rules *Rules) (DistScorer, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &distScorer{
+		classes:      make(map[string]map[string]bool, len(rules.Classes)),
+		rules:        append([]Rule(nil), rules.Rules...),
+		defaultScore: rules.Default,
+	}
+
+	for _, set := range rules.RegionSets {
+		rs := regionSet{
+			regions:   make(map[string]string),
+			neighbors: make(map[string]map[string]bool),
+		}
+		for region, provinces := range set.Regions {
+			for _, province := range provinces {
+				rs.regions[province] = region
+			}
+		}
+		for region, neighbors := range set.Neighbors {
+			rs.neighbors[region] = make(map[string]bool, len(neighbors))
+			for _, neighbor := range neighbors {
+				rs.neighbors[region][neighbor] = true
+			}
+		}
+		s.sets = append(s.sets, rs)
+	}
+
+	for class, provinces := range rules.Classes {
+		s.classes[class] = make(map[string]bool, len(provinces))
+		for _, province := range provinces {
+			s.classes[class][province] = true
+		}
+	}
+	return s, nil
+}
+
+func (s *distScorer) DistScore(client, server Location) (score float32, local bool) {
+	c, v := client, server
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if !holds(rule.SameISP, c.ISP == v.ISP) ||
+			!holds(rule.SameProvince, c.Province == v.Province) ||
+			!holds(rule.SameCity, c.Province == v.Province && c.City != "" && c.City == v.City) ||
+			!s.inClass(rule.ClientClass, c.Province) ||
+			!s.inClass(rule.ServerClass, v.Province) {
+			continue
+		}
+		if rule.SameRegion != nil && !holds(rule.SameRegion, s.sameRegion(c.Province, v.Province)) {
+			continue
+		}
+		if rule.NeighborRegion != nil && !holds(rule.NeighborRegion, s.neighborRegion(c.Province, v.Province)) {
+			continue
+		}
+		return rule.Score, rule.Local
+	}
+	return s.defaultScore, false
+}
+
+// holds tells whether the predicate p holds for the fact.
+func holds(p *bool, fact bool) bool {
+	return p == nil || *p == fact
+}
+
+func (s *distScorer) inClass(class, province string) bool {
+	if class == "" {
+		return true
+	}
+	if strings.HasPrefix(class, "!") {
+		return !s.classes[class[1:]][province]
+	}
+	return s.classes[class][province]
+}
+
+func (s *distScorer) sameRegion(a, b string) bool {
+	for _, set := range s.sets {
+		if set.regions[a] == set.regions[b] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *distScorer) neighborRegion(client, server string) bool {
+	for _, set := range s.sets {
+		if set.neighbors[set.regions[client]][set.regions[server]] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rule
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/someonegg/rsdmatch/distscore"
+	"github.com/someonegg/rsdmatch/distscore/china"
+)
+
+func TestChinaRules(t *testing.T) {
+	s, err := NewDistScorer(DefaultRules())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	provinces := []string{
+		"辽宁", "吉林", "黑龙江", "河北", "北京", "天津", "山西", "内蒙古", "山东", "河南",
+		"湖北", "湖南", "江苏", "安徽", "浙江", "江西", "福建", "上海", "广东", "广西", "海南",
+		"陕西", "宁夏", "甘肃", "青海", "四川", "云南", "贵州", "重庆", "新疆", "西藏",
+		"台湾", "香港", "澳门", "中国", "火星", "月球",
+	}
+	isps := []string{"电信", "联通"}
+	cities := []string{"", "a", "b"}
+
+	// 与 china.DistScore 的结果完全一致
+	for _, cp := range provinces {
+		for _, sp := range provinces {
+			for _, ci := range isps {
+				for _, si := range isps {
+					for _, cc := range cities {
+						for _, sc := range cities {
+							c := Location{ISP: ci, Province: cp, City: cc}
+							v := Location{ISP: si, Province: sp, City: sc}
+							wantScore, wantLocal := china.DistScore(c, v)
+							score, local := s.DistScore(c, v)
+							if score != wantScore || local != wantLocal {
+								t.Errorf("%v -> %v: expected %v and %v, got %v and %v",
+									c, v, wantScore, wantLocal, score, local)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDistScore(t *testing.T) {
+	data := `{
+  "region_sets": [{"regions": {"north": ["a", "b"], "south": ["c"]}, "neighbors": {"north": ["south"]}}],
+  "classes": {"edge": ["d"]},
+  "rules": [
+    {"same_isp": true, "same_province": true, "score": 5, "local": true},
+    {"same_isp": true, "same_region": true, "score": 15},
+    {"same_isp": true, "neighbor_region": true, "score": 25},
+    {"same_isp": false, "server_class": "!edge", "score": 65},
+    {"client_class": "edge", "score": 90}
+  ],
+  "default": 95
+}`
+	rules, err := ReadRules(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s, err := NewDistScorer(rules)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		client    Location
+		server    Location
+		wantScore float32
+		wantLocal bool
+	}{
+		{"SameProvince", Location{ISP: "x", Province: "a"}, Location{ISP: "x", Province: "a"}, 5, true},
+		{"SameRegion", Location{ISP: "x", Province: "a"}, Location{ISP: "x", Province: "b"}, 15, false},
+		{"Neighbor", Location{ISP: "x", Province: "a"}, Location{ISP: "x", Province: "c"}, 25, false},
+		{"NotNeighbor", Location{ISP: "x", Province: "c"}, Location{ISP: "x", Province: "a"}, 95, false},
+		{"NotClass", Location{ISP: "x", Province: "a"}, Location{ISP: "y", Province: "c"}, 65, false},
+		{"Class", Location{ISP: "x", Province: "d"}, Location{ISP: "y", Province: "d"}, 90, false},
+		{"Default", Location{ISP: "x", Province: "a"}, Location{ISP: "y", Province: "d"}, 95, false},
+	}
+	for _, c := range cases {
+		score, local := s.DistScore(c.client, c.server)
+		if score != c.wantScore || local != c.wantLocal {
+			t.Errorf("%s: expected %v and %v, got %v and %v", c.name, c.wantScore, c.wantLocal, score, local)
+		}
+	}
+}
+
+func TestReadRules_Invalid(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+	}{
+		{"Syntax", `{"rules": [`},
+		{"UnknownField", `{"rules": [{"same_country": true, "score": 10}]}`},
+		{"UnknownClass", `{"rules": [{"server_class": "!edge", "score": 10}]}`},
+		{"UnknownNeighbor", `{"region_sets": [{"regions": {"a": ["x"]}, "neighbors": {"a": ["b"]}}]}`},
+		{"InvalidScore", `{"rules": [{"score": 120}]}`},
+		{"InvalidDefault", `{"default": -1}`},
+	}
+	for _, c := range cases {
+		if _, err := ReadRules(strings.NewReader(c.data)); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+
+	if _, err := NewDistScorer(&Rules{Rules: []Rule{{ClientClass: "edge"}}}); err == nil {
+		t.Errorf("Expected error for unknown class")
+	}
+}
+
+func TestReadYAMLRules(t *testing.T) {
+	data := `
+classes:
+  edge: [d]
+rules:
+  - {same_isp: true, same_province: true, score: 5, local: true}
+  - client_class: edge
+    score: 90
+default: 95
+`
+	rules, err := ReadYAMLRules(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s, err := NewDistScorer(rules)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if score, local := s.DistScore(Location{ISP: "x", Province: "a"}, Location{ISP: "x", Province: "a"}); score != 5 || !local {
+		t.Errorf("Expected 5 and local, got %v and %v", score, local)
+	}
+	if score, _ := s.DistScore(Location{ISP: "x", Province: "d"}, Location{ISP: "y", Province: "a"}); score != 90 {
+		t.Errorf("Expected 90, got %v", score)
+	}
+
+	// 与 JSON 相同，未知字段和无效的规则被拒绝
+	for _, data := range []string{"rules: [", "rules: [{same_country: true, score: 10}]", "default: -1"} {
+		if _, err := ReadYAMLRules(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected error for %q", data)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"math"
+)
+
+// domainCap returns the max amount the buyer can buy from a single domain, see
+// Buyer.MaxDomainShare and Buyer.MinDomains.
+func domainCap(buyer *Buyer) int64 {
+	limit := shareOf(buyer.MaxDomainShare, buyer.Demand)
+	if n := int64(buyer.MinDomains); n > 1 && buyer.Demand > 0 {
+		limit = minInt64(limit, (buyer.Demand+n-1)/n)
+	}
+	return limit
+}
+
+// domainUsage records the amounts bought by the buyers from the domains.
+type domainUsage struct {
+	amounts map[string]map[string]int64 // buyer ID => domain => amount
+	caps    map[string]int64            // buyer ID => extra cap of a domain, see withDomainCaps
+}
+
+// newDomainUsage creates a domainUsage with the prior matches and the domain caps
+// carried by ctx.
+func newDomainUsage(ctx context.Context, suppliers []Supplier) domainUsage {
+	u := domainUsage{make(map[string]map[string]int64), domainCaps(ctx)}
+	prior := priorMatches(ctx)
+	if len(prior) == 0 {
+		return u
+	}
+	domains := make(map[string]string, len(suppliers))
+	for i := range suppliers {
+		domains[suppliers[i].ID] = suppliers[i].Domain
+	}
+	for buyerID, records := range prior {
+		for _, record := range records {
+			if domain := domains[record.SupplierID]; domain != "" {
+				u.add(buyerID, domain, record.Amount)
+			}
+		}
+	}
+	return u
+}
+
+// limit returns the max amount the buyer can buy more from the domain of the supplier.
+func (u domainUsage) limit(supplier *Supplier, buyer *Buyer) int64 {
+	if supplier.Domain == "" {
+		return math.MaxInt64
+	}
+	c := domainCap(buyer)
+	if extra, ok := u.caps[buyer.ID]; ok {
+		c = minInt64(c, extra)
+	}
+	if c == math.MaxInt64 {
+		return c
+	}
+	return maxInt64(c-u.amounts[buyer.ID][supplier.Domain], 0)
+}
+
+// take records the amount bought by the buyer from the domain of the supplier.
+func (u domainUsage) take(supplier *Supplier, buyer *Buyer, amount int64) {
+	if supplier.Domain != "" {
+		u.add(buyer.ID, supplier.Domain, amount)
+	}
+}
+
+func (u domainUsage) add(buyerID, domain string, amount int64) {
+	m := u.amounts[buyerID]
+	if m == nil {
+		m = make(map[string]int64)
+		u.amounts[buyerID] = m
+	}
+	m[domain] += amount
+}
+
+type priorKey struct{}
+
+// withPrior returns a copy of ctx that carries the matches made before, in the
+// previous runs of the same buyers, they are counted in the domain constraints. The
+// prior carried by ctx already, e.g. by an outer matcher, is kept.
+func withPrior(ctx context.Context, prior Matches) context.Context {
+	merged := make(Matches, len(prior))
+	mergeMatches(merged, priorMatches(ctx))
+	mergeMatches(merged, prior)
+	return context.WithValue(ctx, priorKey{}, merged)
+}
+
+func priorMatches(ctx context.Context) Matches {
+	m, _ := ctx.Value(priorKey{}).(Matches)
+	return m
+}
+
+type domainCapsKey struct{}
+
+// withDomainCaps returns a copy of ctx that carries the extra caps of the amount a
+// buyer (by ID) can buy from a single domain, counting the prior matches, e.g. the
+// top-up runs of SurvivableMatcher must not grow the largest domain of a buyer.
+func withDomainCaps(ctx context.Context, caps map[string]int64) context.Context {
+	return context.WithValue(ctx, domainCapsKey{}, caps)
+}
+
+func domainCaps(ctx context.Context) map[string]int64 {
+	caps, _ := ctx.Value(domainCapsKey{}).(map[string]int64)
+	return caps
+}
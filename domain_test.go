@@ -0,0 +1,180 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"math"
+	"testing"
+)
+
+func makeDomainSupplier(id string, cap int64, domain string) Supplier {
+	s := makeSupplier(id, cap, 1, nil)
+	s.Domain = domain
+	return s
+}
+
+func domainAmount(suppliers []Supplier, records []BuyRecord, domain string) int64 {
+	total := int64(0)
+	for _, record := range records {
+		for i := range suppliers {
+			if suppliers[i].ID == record.SupplierID && suppliers[i].Domain == domain {
+				total += record.Amount
+			}
+		}
+	}
+	return total
+}
+
+// 1. 故障域上限计算
+func TestDomainCap(t *testing.T) {
+	tests := []struct {
+		share   float32
+		domains int
+		want    int64
+	}{
+		{0, 0, math.MaxInt64},
+		{1, 1, math.MaxInt64},
+		{0.5, 0, 50},
+		{0, 3, 34},
+		{0.5, 3, 34},
+		{0.2, 3, 20},
+	}
+	for _, tt := range tests {
+		buyer := Buyer{Demand: 100, MaxDomainShare: tt.share, MinDomains: tt.domains}
+		if got := domainCap(&buyer); got != tt.want {
+			t.Errorf("domainCap(%v, %d) = %d, want %d", tt.share, tt.domains, got, tt.want)
+		}
+	}
+}
+
+// 2. 所有匹配器都遵守故障域占比上限
+func TestMatchers_MaxDomainShare(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		// idc1 的 s1、s2 最便宜，但 b1 最多只能从一个故障域买 50%
+		suppliers := []Supplier{
+			makeDomainSupplier("s1", 100, "idc1"),
+			makeDomainSupplier("s2", 100, "idc1"),
+			makeDomainSupplier("s3", 100, "idc2"),
+			makeDomainSupplier("s4", 100, ""),
+		}
+		b1 := makeBuyer("b1", 100, nil)
+		b1.MaxDomainShare = 0.5
+		buyers := []Buyer{b1}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b1", 10.0)
+		affinity.setPrice("s3", "b1", 20.0)
+		affinity.setPrice("s4", "b1", 30.0)
+		return suppliers, buyers, affinity
+	}
+
+	for name, m := range map[string]Matcher{
+		"Greedy":  GreedyMatcher(1.0, 0.0, 0, false, false),
+		"MinCost": MinCostMatcher(false),
+		"Fair":    FairMatcher(GreedyMatcher(1.0, 0.0, 0, false, false), MaxMinFair),
+	} {
+		t.Run(name, func(t *testing.T) {
+			suppliers, buyers, affinity := newCase()
+			original := append([]Supplier(nil), suppliers...)
+			matches, perfect := m.Match(suppliers, buyers, affinity)
+
+			if !perfect {
+				t.Fatalf("Expected perfect match, got %v", matches)
+			}
+			if vs := Verify(original, buyers, affinity, matches, false); vs != nil {
+				t.Errorf("Unexpected violations: %v", vs)
+			}
+			if amount := domainAmount(original, matches["b1"], "idc1"); amount != 50 {
+				t.Errorf("Expected 50 from idc1, got %d: %v", amount, matches["b1"])
+			}
+		})
+	}
+
+	t.Run("Exclusive", func(t *testing.T) {
+		suppliers, buyers, affinity := newCase()
+		original := append([]Supplier(nil), suppliers...)
+		matches, _ := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+
+		if vs := Verify(original, buyers, affinity, matches, true); vs != nil {
+			t.Errorf("Unexpected violations: %v", vs)
+		}
+		if len(matches["b1"]) != 1 || matches["b1"][0].SupplierID != "s4" {
+			t.Errorf("Expected b1 to take s4 only, got %v", matches["b1"])
+		}
+	})
+}
+
+// 3. 故障域不足时无法满足最少故障域数
+func TestMatchers_MinDomains(t *testing.T) {
+	suppliers := []Supplier{
+		makeDomainSupplier("s1", 100, "idc1"),
+		makeDomainSupplier("s2", 100, "idc1"),
+	}
+	b1 := makeBuyer("b1", 90, nil)
+	b1.MinDomains = 3
+	buyers := []Buyer{b1}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 10.0)
+
+	matches, perfect := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+
+	if perfect {
+		t.Errorf("Expected imperfect match, got %v", matches)
+	}
+	if total := sumRecords(matches["b1"]); total != 30 {
+		t.Errorf("Expected 30 from the only domain, got %d", total)
+	}
+}
+
+// 4. 公平匹配的两轮合计也不超出故障域上限
+func TestFairMatcher_MaxDomainShare(t *testing.T) {
+	suppliers := []Supplier{
+		makeDomainSupplier("s1", 50, "idc1"),
+		makeDomainSupplier("s2", 50, "idc1"),
+		makeDomainSupplier("s3", 10, "idc2"),
+	}
+	var buyers []Buyer
+	for _, id := range []string{"b1", "b2"} {
+		b := makeBuyer(id, 60, nil)
+		b.MaxDomainShare = 0.5
+		buyers = append(buyers, b)
+	}
+	affinity := newMockAffinityTable()
+	for _, s := range suppliers {
+		affinity.setPrice(s.ID, "b1", 10.0)
+		affinity.setPrice(s.ID, "b2", 10.0)
+	}
+
+	original := append([]Supplier(nil), suppliers...)
+	for _, mode := range []string{MaxMinFair, ProportionalFair} {
+		ss := append([]Supplier(nil), original...)
+		bs := append([]Buyer(nil), buyers...)
+		matches, _ := FairMatcher(GreedyMatcher(1.0, 0.0, 0, false, false), mode).Match(ss, bs, affinity)
+		if vs := Verify(original, buyers, affinity, matches, false); vs != nil {
+			t.Errorf("%s: unexpected violations: %v", mode, vs)
+		}
+	}
+}
+
+// 5. 校验超出故障域上限
+func TestVerify_OverDomain(t *testing.T) {
+	suppliers := []Supplier{
+		makeDomainSupplier("s1", 100, "idc1"),
+		makeDomainSupplier("s2", 100, "idc1"),
+	}
+	b1 := makeBuyer("b1", 100, nil)
+	b1.MaxDomainShare = 0.5
+	buyers := []Buyer{b1}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 10.0)
+
+	matches := Matches{"b1": {{"s1", 40}, {"s2", 40}}}
+	vs := Verify(suppliers, buyers, affinity, matches, false)
+	if len(vs) != 1 || vs[0].Kind != ViolationOverDomain || vs[0].Domain != "idc1" || vs[0].Amount != 80 || vs[0].Limit != 50 {
+		t.Errorf("Expected idc1 over domain, got %v", vs)
+	}
+}
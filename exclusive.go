@@ -0,0 +1,317 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+type exclusiveMatcher struct {
+	greedy  Matcher
+	verbose bool
+}
+
+// ExclusiveOption configures NewExclusiveMatcher.
+type ExclusiveOption struct {
+	// The option of the greedy matching the rounds are compared with, Greedy.Exclusive
+	// is always set.
+	Greedy  GreedyOption `json:"greedy"`
+	Verbose bool         `json:"verbose"`
+}
+
+// The max work (rows² × columns) of a round, above which the rounds stop, so that a
+// large instance falls back to the greedy matching.
+const exclusiveMaxWork = 1e9
+
+// NewExclusiveMatcher creates a matching algorithm for the exclusive mode: each
+// supplier goes whole to a single buyer, or stays unused.
+//
+// Only suppliers that are still whole (CapRest == Cap), whose BuyLimit, extra
+// capacities and domain constraints (see Buyer.MaxDomainShare) allow the entire
+// capacity, and that can serve one more buyer (see Supplier.MaxBuyers) can be
+// assigned. The matching proceeds in rounds, each round is an assignment problem
+// solved by the Hungarian algorithm, in which every buyer with unmet demand gets at
+// most one more supplier. Assigning supplier s to buyer b covers
+// c = min(s.Cap, b.DemandRest), and each round:
+//  1. maximizes the covered demand,
+//  2. then minimizes the price-weighted covered demand,
+//  3. then prefers suppliers that leave less capacity beyond the demand, so that
+//     large suppliers are kept for large buyers.
+//
+// The rounds are a heuristic, a round can take a supplier that a later round needs
+// more. So the greedy matching of o.Greedy in exclusive mode is tried too, and the
+// result with less unmet demand (then the lower price-weighted amount) is taken, it
+// is never worse than the greedy one. The rounds stop when one gets too large.
+//
+// Price tiers, price bottom and enough supplier count are not used by the rounds.
+func NewExclusiveMatcher(o ExclusiveOption) Matcher {
+	o.Greedy.Exclusive = true
+	return exclusiveMatcher{NewGreedyMatcher(o.Greedy), o.Verbose}
+}
+
+// ExclusiveMatcher creates an exclusive matching algorithm, see NewExclusiveMatcher,
+// which is compared with GreedyMatcher(1.0, 0.0, 0, true, verbose).
+func ExclusiveMatcher(verbose bool) Matcher {
+	return NewExclusiveMatcher(ExclusiveOption{
+		Greedy:  GreedyOption{Sensitivity: 1.0, Verbose: verbose},
+		Verbose: verbose,
+	})
+}
+
+type exclusiveCandidate struct {
+	supplier int
+	price    float32
+}
+
+func (m exclusiveMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool) {
+	matches, perfect, _ = m.MatchContext(context.Background(), suppliers, buyers, affinities)
+	return
+}
+
+// MatchContext stops between rounds when ctx is done.
+func (m exclusiveMatcher) MatchContext(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool, err error) {
+	// Both are tried on copies without tracing, then the better one is run again for
+	// real, so that the tracer only sees the taken one.
+	greedy := func(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (Matches, bool, error) {
+		return MatchContext(ctx, m.greedy, suppliers, buyers, affinities)
+	}
+
+	var (
+		unmet [2]int64
+		cost  [2]float64
+	)
+	for k, run := range []func(context.Context, []Supplier, []Buyer, AffinityTable) (Matches, bool, error){
+		m.matchRounds, greedy,
+	} {
+		k := k
+		dryCtx := WithTracer(ctx, TracerFunc(func(e Event) {
+			if a, ok := e.(Allocated); ok {
+				cost[k] += float64(a.Price) * float64(a.Amount)
+			}
+		}))
+		dryBuyers := append([]Buyer(nil), buyers...)
+		if _, _, err = run(dryCtx, copySuppliers(suppliers), dryBuyers, affinities); err != nil {
+			return
+		}
+		for j := range dryBuyers {
+			unmet[k] += maxInt64(dryBuyers[j].DemandRest, 0)
+		}
+	}
+
+	if unmet[1] < unmet[0] || unmet[1] == unmet[0] && cost[1] < cost[0] {
+		return greedy(ctx, suppliers, buyers, affinities)
+	}
+	return m.matchRounds(ctx, suppliers, buyers, affinities)
+}
+
+// matchRounds matches by the rounds of assignment problems.
+func (m exclusiveMatcher) matchRounds(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool, err error) {
+	matches = make(Matches, len(buyers))
+	tracer := contextTracer(ctx, m.verbose)
+	domains := newDomainUsage(ctx, suppliers)
+
+	candidates := make([][]exclusiveCandidate, len(buyers))
+	ceiling := float32(0)
+
+	err = findAffinities(ctx, suppliers, buyers, affinities, func(i, j int, price float32, limit int64) {
+		supplier := &suppliers[i]
+		if supplier.Cap <= 0 || supplier.CapRest != supplier.Cap || limit < supplier.Cap ||
+			extraLimit(supplier, &buyers[j]) < supplier.Cap || !canServe(supplier, false) ||
+			domains.limit(supplier, &buyers[j]) < supplier.Cap {
+			return
+		}
+		candidates[j] = append(candidates[j], exclusiveCandidate{i, price})
+		if price > ceiling {
+			ceiling = price
+		}
+	})
+	if err != nil {
+		return
+	}
+	ceiling += 1.0
+
+	// Rows and columns follow the buyerOrder and supplierOrder, so the assignment does
+	// not depend on the order of the input slices.
+	border, srank := buyerOrder(buyers), ranks(supplierOrder(suppliers))
+	for _, cs := range candidates {
+		sort.Slice(cs, func(x, y int) bool {
+			return srank[cs[x].supplier] < srank[cs[y].supplier]
+		})
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		var rows []int            // buyers with unmet demand and any whole candidate
+		cols := make(map[int]int) // supplier => column
+		var colSuppliers []int
+		for _, j := range border {
+			if buyers[j].DemandRest <= 0 {
+				continue
+			}
+			row := false
+			for _, c := range candidates[j] {
+				if suppliers[c.supplier].CapRest != suppliers[c.supplier].Cap {
+					continue
+				}
+				row = true
+				if _, ok := cols[c.supplier]; ok {
+					continue
+				}
+				cols[c.supplier] = len(colSuppliers)
+				colSuppliers = append(colSuppliers, c.supplier)
+			}
+			if row {
+				rows = append(rows, j)
+			}
+		}
+		if len(rows) == 0 || len(colSuppliers) == 0 {
+			break
+		}
+		if n := float64(len(rows)); n*n*float64(len(colSuppliers)) > exclusiveMaxWork {
+			break
+		}
+
+		// Unassignable pairs and padding columns cost 0, all real assignments cost < 0.
+		// The cost is lexicographic: the price-weighted term of any assignment sums to
+		// less than one unit of covered demand, and the waste term to less than one unit
+		// of the price-weighted term.
+		width := len(colSuppliers)
+		if width < len(rows) {
+			width = len(rows)
+		}
+		priceScale := 1.0
+		for _, j := range rows {
+			priceScale += float64(ceiling) * float64(buyers[j].DemandRest)
+		}
+		wasteScale := priceScale * float64(len(rows)+1)
+		cost := make([][]float64, len(rows))
+		for r, j := range rows {
+			cost[r] = make([]float64, width)
+			demandRest := buyers[j].DemandRest
+			for _, c := range candidates[j] {
+				col, ok := cols[c.supplier]
+				if !ok || domains.limit(&suppliers[c.supplier], &buyers[j]) < suppliers[c.supplier].Cap {
+					continue
+				}
+				capacity := suppliers[c.supplier].Cap
+				covered := minInt64(capacity, demandRest)
+				waste := float64(capacity-covered) / float64(capacity)
+				cost[r][col] = -float64(covered) + float64(c.price)*float64(covered)/priceScale + waste/wasteScale
+			}
+		}
+
+		assigned := false
+		for r, col := range hungarian(cost) {
+			if col >= len(colSuppliers) || cost[r][col] >= 0 {
+				continue
+			}
+			supplier, buyer := &suppliers[colSuppliers[col]], &buyers[rows[r]]
+			amount := supplier.CapRest
+			matches[buyer.ID] = append(matches[buyer.ID], BuyRecord{supplier.ID, amount})
+			supplier.CapRest -= amount
+			buyer.DemandRest -= amount
+			takeExtra(supplier, buyer, amount)
+			takeBuyer(supplier)
+			domains.take(supplier, buyer, amount)
+			assigned = true
+
+			if tracer != nil {
+				for _, c := range candidates[rows[r]] {
+					if c.supplier == colSuppliers[col] {
+						tracer.Trace(Allocated{buyer.ID, supplier.ID, c.price, amount})
+					}
+				}
+			}
+		}
+		if !assigned {
+			break
+		}
+	}
+
+	perfect = true
+	for j := 0; j < len(buyers); j++ {
+		if buyers[j].DemandRest > 0 {
+			perfect = false
+			break
+		}
+	}
+	return
+}
+
+// hungarian solves the assignment problem for an n×m cost matrix (n <= m), returns
+// the column assigned to each row with the min total cost.
+func hungarian(cost [][]float64) []int {
+	n := len(cost)
+	if n == 0 {
+		return nil
+	}
+	m := len(cost[0])
+	inf := math.Inf(1)
+
+	// 1-based potentials and matching, p[j] is the row matched to column j.
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)
+	way := make([]int, m+1)
+	minv := make([]float64, m+1)
+	used := make([]bool, m+1)
+
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		for j := 0; j <= m; j++ {
+			minv[j] = inf
+			used[j] = false
+		}
+		for {
+			used[j0] = true
+			i0, delta, j1 := p[j0], inf, 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				cur := cost[i0-1][j-1] - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	assignment := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			assignment[p[j]-1] = j - 1
+		}
+	}
+	return assignment
+}
@@ -0,0 +1,275 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"testing"
+)
+
+// 1. 大节点不应被小买家占用
+func TestExclusiveMatcher_NoStranding(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+			makeSupplier("s2", 50, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 50, nil),
+			makeBuyer("b2", 100, nil),
+		}
+		// b1 的价格层更低，贪心先为 b1 分配
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b1", 10.0)
+		affinity.setPrice("s1", "b2", 20.0)
+		affinity.setPrice("s2", "b2", 20.0)
+		return suppliers, buyers, affinity
+	}
+
+	suppliers, buyers, affinity := newCase()
+	_, perfect := GreedyMatcher(1.0, 0.0, 0, true, false).Match(suppliers, buyers, affinity)
+	if perfect {
+		t.Fatal("Expected greedy to strand the large supplier")
+	}
+
+	suppliers, buyers, affinity = newCase()
+	matches, perfect := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+	if !perfect {
+		t.Fatal("Expected perfect match")
+	}
+	if len(matches["b1"]) != 1 || matches["b1"][0] != (BuyRecord{"s2", 50}) {
+		t.Errorf("Expected b1 to take s2, got %v", matches["b1"])
+	}
+	if len(matches["b2"]) != 1 || matches["b2"][0] != (BuyRecord{"s1", 100}) {
+		t.Errorf("Expected b2 to take s1, got %v", matches["b2"])
+	}
+}
+
+// 2. 价格优先测试
+func TestExclusiveMatcher_Price(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 100, 1, nil),
+		makeSupplier("s2", 100, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 100, nil),
+		makeBuyer("b2", 100, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 20.0)
+	affinity.setPrice("s1", "b2", 20.0)
+	affinity.setPrice("s2", "b2", 50.0)
+
+	matches, perfect := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+
+	if !perfect {
+		t.Fatal("Expected perfect match")
+	}
+	// s1->b2 + s2->b1 = 20+20 < s1->b1 + s2->b2 = 10+50
+	if matches["b1"][0].SupplierID != "s2" || matches["b2"][0].SupplierID != "s1" {
+		t.Errorf("Unexpected matches %v", matches)
+	}
+}
+
+// 3. 多轮分配：一个买家需要多个完整节点
+func TestExclusiveMatcher_Rounds(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 50, 1, nil),
+		makeSupplier("s2", 50, 1, nil),
+		makeSupplier("s3", 50, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 120, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 10.0)
+	affinity.setPrice("s3", "b1", 10.0)
+
+	matches, perfect := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+
+	if !perfect {
+		t.Fatal("Expected perfect match")
+	}
+	if len(matches["b1"]) != 3 {
+		t.Errorf("Expected 3 suppliers, got %v", matches["b1"])
+	}
+	for _, record := range matches["b1"] {
+		if record.Amount != 50 {
+			t.Errorf("Expected whole supplier amount 50, got %d", record.Amount)
+		}
+	}
+	for _, s := range suppliers {
+		if s.CapRest != 0 {
+			t.Errorf("Expected supplier %s CapRest 0, got %d", s.ID, s.CapRest)
+		}
+	}
+}
+
+// 4. 部分占用或限制的节点不能独占
+func TestExclusiveMatcher_Rejected(t *testing.T) {
+	t.Run("LimitPreventsFullCapacity", func(t *testing.T) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 150, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setLimit("s1", "b1", 80)
+
+		matches, perfect := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+
+		if len(matches["b1"]) != 0 {
+			t.Errorf("Expected no matches, got %v", matches["b1"])
+		}
+		if perfect {
+			t.Error("Expected non-perfect match")
+		}
+	})
+
+	t.Run("PartiallyUsed", func(t *testing.T) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+		}
+		suppliers[0].CapRest = 60
+		buyers := []Buyer{
+			makeBuyer("b1", 50, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+
+		matches, _ := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+
+		if len(matches["b1"]) != 0 {
+			t.Errorf("Expected no matches, got %v", matches["b1"])
+		}
+	})
+}
+
+// 5. Context 取消测试
+func TestExclusiveMatcher_Context(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 50, 1, nil),
+		makeSupplier("s2", 50, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 100, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 10.0)
+
+	// 收集阶段检查 2 次，然后只允许第一轮分配（直接测试轮次，不与贪心比较）
+	ctx := &countdownContext{context.Background(), 3}
+	matches, perfect, err := ExclusiveMatcher(false).(exclusiveMatcher).matchRounds(ctx, suppliers, buyers, affinity)
+
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if perfect || len(matches["b1"]) != 1 {
+		t.Errorf("Expected 1 supplier after the first round, got %v", matches)
+	}
+	if buyers[0].DemandRest != 50 {
+		t.Errorf("Expected DemandRest 50, got %d", buyers[0].DemandRest)
+	}
+}
+
+// 6. 匈牙利算法测试
+func TestHungarian(t *testing.T) {
+	cost := [][]float64{
+		{4, 1, 3},
+		{2, 0, 5},
+	}
+	assignment := hungarian(cost)
+	// 最优: row0->col1 (1), row1->col0 (2) = 3
+	if assignment[0] != 1 || assignment[1] != 0 {
+		t.Errorf("Unexpected assignment %v", assignment)
+	}
+}
+
+// 7. 覆盖的需求优先于价格
+func TestExclusiveMatcher_CoverageFirst(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 100, 1, nil),
+		makeSupplier("s2", 10, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 100, nil),
+		makeBuyer("b2", 10, nil),
+	}
+	// s2 对 b1 最便宜，但只有 s2 能服务 b2
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 90.0)
+	affinity.setPrice("s2", "b1", 0.0)
+	affinity.setPrice("s2", "b2", 90.0)
+	affinity.setLimit("s1", "b2", 0)
+
+	matches, perfect := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+	if !perfect {
+		t.Fatalf("Expected perfect match, got %v", matches)
+	}
+	if len(matches["b1"]) != 1 || matches["b1"][0] != (BuyRecord{"s1", 100}) {
+		t.Errorf("Expected b1 to take s1, got %v", matches["b1"])
+	}
+	if len(matches["b2"]) != 1 || matches["b2"][0] != (BuyRecord{"s2", 10}) {
+		t.Errorf("Expected b2 to take s2, got %v", matches["b2"])
+	}
+}
+
+// 8. 不劣于排他模式的贪心匹配
+func TestExclusiveMatcher_NotWorseThanGreedy(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		suppliers := []Supplier{
+			makeSupplier("s00", 57, 1, nil),
+			makeSupplier("s01", 54, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b02", 117, nil),
+			makeBuyer("b01", 41, nil),
+			makeBuyer("b00", 33, nil),
+		}
+		// 允许买家整个买下比需求大的供应商
+		affinity := newMockAffinityTable()
+		for _, s := range suppliers {
+			for _, b := range buyers {
+				affinity.setPrice(s.ID, b.ID, 10.0)
+				affinity.setLimit(s.ID, b.ID, s.Cap)
+			}
+		}
+		return suppliers, buyers, affinity
+	}
+	unmet := func(buyers []Buyer) (n int64) {
+		for _, buyer := range buyers {
+			n += maxInt64(buyer.DemandRest, 0)
+		}
+		return
+	}
+
+	// 贪心把两个供应商都给 b02，未满足 80；按轮次匹配则未满足 93
+	suppliers, buyers, affinity := newCase()
+	GreedyMatcher(1.0, 0.0, 0, true, false).Match(suppliers, buyers, affinity)
+	if n := unmet(buyers); n != 80 {
+		t.Fatalf("Expected greedy to leave 80 unmet, got %d", n)
+	}
+
+	suppliers, buyers, affinity = newCase()
+	ExclusiveMatcher(false).(exclusiveMatcher).matchRounds(context.Background(), suppliers, buyers, affinity)
+	if n := unmet(buyers); n != 93 {
+		t.Fatalf("Expected the rounds to leave 93 unmet, got %d", n)
+	}
+
+	suppliers, buyers, affinity = newCase()
+	matches, _ := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+	if n := unmet(buyers); n != 80 {
+		t.Errorf("Expected 80 unmet, got %d: %v", n, matches)
+	}
+	if len(matches["b02"]) != 2 {
+		t.Errorf("Expected b02 to take both suppliers, got %v", matches)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explanation tells why a buyer got (or did not get) a supplier, see Explain.
+type Explanation struct {
+	BuyerID    string `json:"buyer"`
+	SupplierID string `json:"supplier"`
+
+	// The times the pair was considered, only traced by GreedyMatcher.
+	Considered []Considered `json:"considered"`
+	// The total amount allocated to the pair.
+	Allocated int64 `json:"allocated"`
+	// How the matching of the buyer ended in the last run, e.g. the top-up run of
+	// FairMatcher or SurvivableMatcher, nil when not traced.
+	Stopped *BuyerStopped `json:"stopped"`
+}
+
+// Explain explains the (supplier, buyer) pair by the events traced during matching,
+// e.g. Recorder.Events.
+//
+// A pair not considered by GreedyMatcher was either not viable (its BuyLimit is zero),
+// or the buyer was stopped before reaching its price tier, see Explanation.Stopped.
+func Explain(events []Event, buyerID, supplierID string) Explanation {
+	x := Explanation{BuyerID: buyerID, SupplierID: supplierID}
+	for _, e := range events {
+		switch e := e.(type) {
+		case Considered:
+			if e.BuyerID == buyerID && e.SupplierID == supplierID {
+				x.Considered = append(x.Considered, e)
+			}
+		case Allocated:
+			if e.BuyerID == buyerID && e.SupplierID == supplierID {
+				x.Allocated += e.Amount
+			}
+		case BuyerStopped:
+			if e.BuyerID == buyerID {
+				stopped := e
+				x.Stopped = &stopped
+			}
+		}
+	}
+	return x
+}
+
+func (x Explanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s <- %s: allocated %d", x.BuyerID, x.SupplierID, x.Allocated)
+	if len(x.Considered) == 0 {
+		b.WriteString(", not considered")
+	}
+	for _, c := range x.Considered {
+		fmt.Fprintf(&b, "\n  considered at price %v (tier %d), limit %d, cap_rest %d, demand_rest %d, amount %d",
+			c.Price, c.Tier, c.Limit, c.CapRest, c.DemandRest, c.Amount)
+		if c.Skipped != "" {
+			fmt.Fprintf(&b, ", skipped: %s", c.Skipped)
+		}
+	}
+	if s := x.Stopped; s != nil {
+		fmt.Fprintf(&b, "\n  buyer stopped: %s", s.Reason)
+		if s.Reason == StopSatisfied {
+			fmt.Fprintf(&b, " at price %v", s.Price)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// 1. 解释贪心匹配的决策
+func TestExplain(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 100, 1, nil),
+		makeSupplier("s2", 100, 1, nil),
+		makeSupplier("s3", 100, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 50, nil),
+		makeBuyer("b2", 500, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 20.0)
+	affinity.setPrice("s2", "b1", 50.0)
+	affinity.setLimit("s3", "b1", 0)
+	affinity.setPrice("s1", "b2", 30.0)
+	affinity.setLimit("s2", "b2", 0)
+	affinity.setLimit("s3", "b2", 0)
+
+	rec := &Recorder{}
+	ctx := WithTracer(context.Background(), rec)
+	MatchContext(ctx, GreedyMatcher(10.0, 10.0, 0, false, false), suppliers, buyers, affinity)
+
+	t.Run("Allocated", func(t *testing.T) {
+		x := Explain(rec.Events, "b1", "s1")
+		if x.Allocated != 50 || len(x.Considered) != 1 || x.Considered[0].Skipped != "" {
+			t.Errorf("Unexpected %v", x)
+		}
+		if x.Stopped == nil || x.Stopped.Reason != StopSatisfied || x.Stopped.Price != 20.0 {
+			t.Errorf("Expected b1 stopped satisfied at price 20, got %v", x)
+		}
+	})
+
+	t.Run("StoppedBefore", func(t *testing.T) {
+		x := Explain(rec.Events, "b1", "s2")
+		if x.Allocated != 0 || len(x.Considered) != 0 {
+			t.Errorf("Unexpected %v", x)
+		}
+		if !strings.Contains(x.String(), "not considered") ||
+			!strings.Contains(x.String(), "buyer stopped: satisfied at price 20") {
+			t.Errorf("Unexpected %q", x.String())
+		}
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		x := Explain(rec.Events, "b2", "s1")
+		if len(x.Considered) != 1 || x.Considered[0].CapRest != 50 || x.Allocated != 50 {
+			t.Errorf("Unexpected %v", x)
+		}
+		if x.Stopped == nil || x.Stopped.Reason != StopExhausted {
+			t.Errorf("Expected b2 exhausted, got %v", x)
+		}
+	})
+}
+
+// 2. 公平匹配的试运行不应被追踪
+func TestExplain_Fair(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 10, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 10, nil),
+		makeBuyer("b2", 10, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s1", "b2", 10.0)
+
+	rec := &Recorder{}
+	ctx := WithTracer(context.Background(), rec)
+	matcher := FairMatcher(GreedyMatcher(10.0, 10.0, 0, false, false), MaxMinFair)
+	matches, _, _ := MatchContext(ctx, matcher, suppliers, buyers, affinity)
+
+	total := int64(0)
+	for _, e := range rec.Events {
+		if a, ok := e.(Allocated); ok {
+			total += a.Amount
+		}
+	}
+	if total != 10 {
+		t.Errorf("Expected 10 allocated in total, got %d", total)
+	}
+
+	for _, id := range []string{"b1", "b2"} {
+		x := Explain(rec.Events, id, "s1")
+		if len(matches[id]) != 1 || x.Allocated != matches[id][0].Amount || x.Allocated != 5 {
+			t.Errorf("Expected %s allocated 5 as matched %v, got %v", id, matches[id], x)
+		}
+		// 以最后一次运行的结果为准
+		if x.Stopped == nil || x.Stopped.Reason != StopExhausted {
+			t.Errorf("Expected %s exhausted in the last run, got %v", id, x)
+		}
+	}
+}
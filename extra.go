@@ -0,0 +1,67 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"math"
+	"math/bits"
+)
+
+// extraLimit returns the max amount the buyer can buy from the supplier without
+// exceeding its extra capacities, see Buyer.ExtraDemand.
+func extraLimit(supplier *Supplier, buyer *Buyer) int64 {
+	limit := int64(math.MaxInt64)
+	if buyer.Demand <= 0 {
+		return limit
+	}
+	for k, demand := range buyer.ExtraDemand {
+		if demand <= 0 || !extraLimited(supplier, k) {
+			continue
+		}
+		rest := maxInt64(supplier.ExtraCapRest[k], 0)
+		limit = minInt64(limit, mulDiv(rest, buyer.Demand, demand, false))
+	}
+	return limit
+}
+
+func extraLimited(supplier *Supplier, k int) bool {
+	return k < len(supplier.ExtraCap) && k < len(supplier.ExtraCapRest) && supplier.ExtraCap[k] >= 0
+}
+
+// buyable returns the max amount the buyer can buy from the supplier, limited by
+// the BuyLimit, CapRest and the extra capacities.
+func buyable(supplier *Supplier, buyer *Buyer, limit int64) int64 {
+	return minInt64(minInt64(limit, supplier.CapRest), extraLimit(supplier, buyer))
+}
+
+// takeExtra reduces the extra capacities of the supplier by the amount bought.
+func takeExtra(supplier *Supplier, buyer *Buyer, amount int64) {
+	if buyer.Demand <= 0 {
+		return
+	}
+	for k, demand := range buyer.ExtraDemand {
+		if demand <= 0 || !extraLimited(supplier, k) {
+			continue
+		}
+		supplier.ExtraCapRest[k] -= mulDiv(amount, demand, buyer.Demand, true)
+	}
+}
+
+// mulDiv returns a*b/c of non-negative numbers without overflow, rounded up when ceil,
+// saturated to math.MaxInt64.
+func mulDiv(a, b, c int64, ceil bool) int64 {
+	hi, lo := bits.Mul64(uint64(a), uint64(b))
+	if hi >= uint64(c) {
+		return math.MaxInt64
+	}
+	q, r := bits.Div64(hi, lo, uint64(c))
+	if ceil && r > 0 {
+		q++
+	}
+	if q > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(q)
+}
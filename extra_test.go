@@ -0,0 +1,129 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"math"
+	"testing"
+)
+
+func makeExtraSupplier(id string, cap int64, extraCap ...int64) Supplier {
+	s := makeSupplier(id, cap, 1, nil)
+	s.ExtraCap = extraCap
+	s.ExtraCapRest = append([]int64(nil), extraCap...)
+	return s
+}
+
+func makeExtraBuyer(id string, demand int64, extraDemand ...int64) Buyer {
+	b := makeBuyer(id, demand, nil)
+	b.ExtraDemand = extraDemand
+	return b
+}
+
+// 1. 额外维度限制测试
+func TestExtraLimit(t *testing.T) {
+	supplier := makeExtraSupplier("s1", 100, 50, -1)
+	buyer := makeExtraBuyer("b1", 40, 100, 1000)
+
+	// 每单位需求消耗 100/40 = 2.5 存储，50 存储最多 20 单位；连接数不限
+	if limit := extraLimit(&supplier, &buyer); limit != 20 {
+		t.Errorf("Expected limit 20, got %d", limit)
+	}
+
+	takeExtra(&supplier, &buyer, 7) // ceil(7*100/40) = 18
+	if supplier.ExtraCapRest[0] != 32 || supplier.ExtraCapRest[1] != -1 {
+		t.Errorf("Unexpected ExtraCapRest %v", supplier.ExtraCapRest)
+	}
+
+	plain := makeSupplier("s2", 100, 1, nil)
+	if limit := extraLimit(&plain, &buyer); limit != math.MaxInt64 {
+		t.Errorf("Expected unlimited, got %d", limit)
+	}
+
+	if v := mulDiv(math.MaxInt64, 4, 2, false); v != math.MaxInt64 {
+		t.Errorf("Expected saturated, got %d", v)
+	}
+	if v := mulDiv(math.MaxInt64/2, 4, 8, true); v != math.MaxInt64/4+1 {
+		t.Errorf("Unexpected mulDiv %d", v)
+	}
+}
+
+// 2. 所有匹配器都遵守额外维度的容量
+func TestMatchers_ExtraCap(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		// s1 带宽足够，但存储只够一半需求；s2 更贵但不限存储
+		suppliers := []Supplier{
+			makeExtraSupplier("s1", 100, 50),
+			makeExtraSupplier("s2", 100),
+		}
+		buyers := []Buyer{
+			makeExtraBuyer("b1", 40, 100),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b1", 30.0)
+		return suppliers, buyers, affinity
+	}
+
+	for name, m := range map[string]Matcher{
+		"Greedy":  GreedyMatcher(1.0, 0.0, 0, false, false),
+		"MinCost": MinCostMatcher(false),
+	} {
+		t.Run(name, func(t *testing.T) {
+			suppliers, buyers, affinity := newCase()
+			matches, perfect := m.Match(suppliers, buyers, affinity)
+
+			if !perfect {
+				t.Fatalf("Expected perfect match, got %v", matches)
+			}
+			for _, record := range matches["b1"] {
+				if record.SupplierID == "s1" && record.Amount != 20 {
+					t.Errorf("Expected 20 from s1, got %d", record.Amount)
+				}
+			}
+			if suppliers[0].ExtraCapRest[0] != 0 {
+				t.Errorf("Expected s1 storage exhausted, got %d", suppliers[0].ExtraCapRest[0])
+			}
+		})
+	}
+
+	t.Run("Exclusive", func(t *testing.T) {
+		suppliers, buyers, affinity := newCase()
+		matches, _ := ExclusiveMatcher(false).Match(suppliers, buyers, affinity)
+
+		if len(matches["b1"]) != 1 || matches["b1"][0].SupplierID != "s2" {
+			t.Errorf("Expected b1 to take s2 only, got %v", matches["b1"])
+		}
+	})
+}
+
+// 3. 多个买家共享额外容量
+func TestMinCostMatcher_SharedExtraCap(t *testing.T) {
+	suppliers := []Supplier{
+		makeExtraSupplier("s1", 100, 60),
+		makeExtraSupplier("s2", 100),
+	}
+	buyers := []Buyer{
+		makeExtraBuyer("b1", 40, 40),
+		makeExtraBuyer("b2", 40, 40),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s1", "b2", 10.0)
+	affinity.setPrice("s2", "b1", 30.0)
+	affinity.setPrice("s2", "b2", 30.0)
+
+	matches, perfect := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+
+	if !perfect {
+		t.Fatalf("Expected perfect match, got %v", matches)
+	}
+	if suppliers[0].ExtraCapRest[0] < 0 {
+		t.Errorf("Expected s1 storage not exceeded, got %d", suppliers[0].ExtraCapRest[0])
+	}
+	if suppliers[0].CapRest != 40 {
+		t.Errorf("Expected 60 bought from s1, got %d", 100-suppliers[0].CapRest)
+	}
+}
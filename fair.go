@@ -0,0 +1,252 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"sort"
+)
+
+// The fairness modes of FairMatcher.
+const (
+	// Every buyer gets the same amount, but no more than its demand.
+	MaxMinFair = "maxmin"
+	// Every buyer gets the same ratio of its demand.
+	ProportionalFair = "proportional"
+)
+
+type fairMatcher struct {
+	m    Matcher
+	mode string
+}
+
+// FairMatcher wraps m to serve the buyers by Buyer.Priority: the buyers of a higher
+// priority are matched first, the lower ones only get the rest of the suppliers.
+//
+// When mode is MaxMinFair or ProportionalFair, the shortage of the buyers with the same
+// priority is spread by the mode: a dry run of m finds out the total amount that can be
+// matched, which is divided into targets by the mode. Then m is run with the demands
+// reduced to the targets, and run again with the real demands for the rest that some
+// buyers can not reach. With an empty mode, m is run once for each priority.
+//
+// A supplier that runs out of Supplier.BuyersRest in the first run can not sell more
+// to its buyers in the second run.
+func FairMatcher(m Matcher, mode string) Matcher {
+	return fairMatcher{m, mode}
+}
+
+func (m fairMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool) {
+	matches, perfect, _ = m.MatchContext(context.Background(), suppliers, buyers, affinities)
+	return
+}
+
+func (m fairMatcher) MatchContext(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool, err error) {
+	matches = make(Matches, len(buyers))
+
+	order := buyerOrder(buyers)
+	for start, end := 0, 0; start < len(order); start = end {
+		end = start + 1
+		for end < len(order) && buyers[order[end]].Priority == buyers[order[start]].Priority {
+			end++
+		}
+
+		if err = m.matchClass(ctx, suppliers, buyers, order[start:end], affinities, matches); err != nil {
+			return
+		}
+	}
+
+	perfect = true
+	for j := 0; j < len(buyers); j++ {
+		if buyers[j].DemandRest > 0 {
+			perfect = false
+			break
+		}
+	}
+	return
+}
+
+// matchClass matches the buyers (indexes) with the same priority.
+func (m fairMatcher) matchClass(ctx context.Context, suppliers []Supplier, buyers []Buyer, class []int,
+	affinities AffinityTable, matches Matches) (err error) {
+
+	sub := make([]Buyer, len(class))
+	for k, j := range class {
+		sub[k] = buyers[j]
+	}
+	defer func() {
+		for k, j := range class {
+			buyers[j].DemandRest = sub[k].DemandRest
+		}
+	}()
+
+	// The BuyLimits are reduced by the amounts bought in the previous passes.
+	bought := make(Matches, len(sub))
+	rested := mapAffinities(affinities, func(supplier *Supplier, buyer *Buyer, a Affinity) Affinity {
+		for _, record := range bought[buyer.ID] {
+			if record.SupplierID == supplier.ID {
+				a.Limit = restLimit{a.Limit, maxShare(buyer), record.Amount}
+				break
+			}
+		}
+		return a
+	})
+
+	run := func() error {
+		ms, _, err := MatchContext(withPrior(ctx, bought), m.m, suppliers, sub, rested)
+		restoreBuyers(suppliers, bought, ms)
+		mergeMatches(matches, ms)
+		mergeMatches(bought, ms)
+		return err
+	}
+
+	if m.mode != MaxMinFair && m.mode != ProportionalFair || len(sub) < 2 {
+		return run()
+	}
+
+	needs := make([]int64, len(sub))
+	for k := range sub {
+		needs[k] = maxInt64(sub[k].DemandRest, 0)
+	}
+
+	// The dry run, its events are discarded so that the tracer only sees the real runs.
+	dryCtx := WithTracer(ctx, TracerFunc(func(Event) {}))
+	dry := copySuppliers(suppliers)
+	drySub := append([]Buyer(nil), sub...)
+	if _, _, err = MatchContext(dryCtx, m.m, dry, drySub, affinities); err != nil {
+		return
+	}
+	total := int64(0)
+	for k := range drySub {
+		total += needs[k] - maxInt64(drySub[k].DemandRest, 0)
+	}
+
+	targets := fairTargets(m.mode, needs, total)
+	if targets == nil {
+		return run()
+	}
+
+	for k := range sub {
+		sub[k].DemandRest = targets[k]
+	}
+	err = run()
+	for k := range sub {
+		got := targets[k] - sub[k].DemandRest
+		sub[k].DemandRest = needs[k] - got
+	}
+	if err != nil {
+		return
+	}
+
+	return run()
+}
+
+// fairTargets divides total into targets by mode, the targets are not more than needs.
+// It returns nil when all needs can be satisfied.
+func fairTargets(mode string, needs []int64, total int64) []int64 {
+	sum := int64(0)
+	for _, need := range needs {
+		sum += need
+	}
+	if total >= sum {
+		return nil
+	}
+
+	targets := make([]int64, len(needs))
+	switch mode {
+	case MaxMinFair:
+		// water-filling
+		sorted := append([]int64(nil), needs...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		level, rest := int64(0), total
+		for k, need := range sorted {
+			n := int64(len(sorted) - k)
+			if (need-level)*n > rest {
+				level += rest / n
+				break
+			}
+			rest -= (need - level) * n
+			level = need
+		}
+		for k, need := range needs {
+			targets[k] = minInt64(need, level)
+		}
+	case ProportionalFair:
+		for k, need := range needs {
+			targets[k] = mulDiv(need, total, sum, false)
+		}
+	}
+
+	// Spread the remainder in order.
+	rest := total
+	for _, target := range targets {
+		rest -= target
+	}
+	for k := 0; rest > 0 && k < len(targets); k++ {
+		if targets[k] < needs[k] {
+			targets[k]++
+			rest--
+		}
+	}
+	return targets
+}
+
+type restLimit struct {
+	limit  BuyLimit // can be nil
+	share  int64    // see Buyer.MaxShare
+	bought int64
+}
+
+func (l restLimit) Calculate(supplierCap, buyerDemand int64) int64 {
+	limit := l.share
+	if l.limit != nil {
+		limit = minInt64(limit, l.limit.Calculate(supplierCap, buyerDemand))
+	}
+	return limit - l.bought
+}
+
+func copySuppliers(suppliers []Supplier) []Supplier {
+	copied := append([]Supplier(nil), suppliers...)
+	for i := range copied {
+		copied[i].ExtraCapRest = append([]int64(nil), copied[i].ExtraCapRest...)
+	}
+	return copied
+}
+
+// restoreBuyers gives back the BuyersRest taken again by the records of ms, whose
+// suppliers are recorded in bought already.
+func restoreBuyers(suppliers []Supplier, bought, ms Matches) {
+	var index map[string]int
+	for buyerID, records := range ms {
+		for _, record := range records {
+			if recordIndex(bought[buyerID], record.SupplierID) < 0 {
+				continue
+			}
+			if index == nil {
+				index = make(map[string]int, len(suppliers))
+				for i := range suppliers {
+					index[suppliers[i].ID] = i
+				}
+			}
+			if i, ok := index[record.SupplierID]; ok && suppliers[i].MaxBuyers > 0 {
+				suppliers[i].BuyersRest++
+			}
+		}
+	}
+}
+
+// mergeMatches adds the records of src to dst.
+func mergeMatches(dst, src Matches) {
+	for buyerID, records := range src {
+		for _, record := range records {
+			merged := dst[buyerID]
+			if k := recordIndex(merged, record.SupplierID); k >= 0 {
+				merged[k].Amount += record.Amount
+			} else {
+				merged = append(merged, record)
+			}
+			dst[buyerID] = merged
+		}
+	}
+}
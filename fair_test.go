@@ -0,0 +1,104 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func shortCase() ([]Supplier, []Buyer, AffinityTable) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 60, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 60, nil),
+		makeBuyer("b2", 20, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s1", "b2", 10.0)
+	return suppliers, buyers, affinity
+}
+
+// 1. 供应不足时的公平分配
+func TestFairMatcher_Modes(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected map[string]int64
+	}{
+		{"", map[string]int64{"b1": 60, "b2": 0}},
+		{MaxMinFair, map[string]int64{"b1": 40, "b2": 20}},
+		{ProportionalFair, map[string]int64{"b1": 45, "b2": 15}},
+	}
+
+	for _, tt := range tests {
+		for name, inner := range map[string]Matcher{
+			"Greedy":  GreedyMatcher(1.0, 0.0, 0, false, false),
+			"MinCost": MinCostMatcher(false),
+		} {
+			t.Run(tt.mode+"/"+name, func(t *testing.T) {
+				suppliers, buyers, affinity := shortCase()
+				matches, perfect := FairMatcher(inner, tt.mode).Match(suppliers, buyers, affinity)
+
+				if perfect {
+					t.Error("Expected non-perfect match")
+				}
+				if name == "MinCost" && tt.mode == "" {
+					return // 最小成本匹配不保证短缺落在哪个买家
+				}
+				for buyerID, amount := range tt.expected {
+					if got := sumAmount(matches[buyerID]); got != amount {
+						t.Errorf("Expected %s to get %d, got %d", buyerID, amount, got)
+					}
+				}
+				for _, b := range buyers {
+					if b.DemandRest != b.Demand-tt.expected[b.ID] {
+						t.Errorf("Expected %s DemandRest %d, got %d", b.ID, b.Demand-tt.expected[b.ID], b.DemandRest)
+					}
+				}
+			})
+		}
+	}
+}
+
+// 2. 高优先级买家优先满足
+func TestFairMatcher_Priority(t *testing.T) {
+	suppliers, buyers, affinity := shortCase()
+	buyers[1].Priority = 1
+
+	// 低优先级的 b1 价格更低也不能抢占 b2
+	affinity.(*mockAffinityTable).setPrice("s1", "b2", 50.0)
+
+	matches, _ := FairMatcher(GreedyMatcher(1.0, 0.0, 0, false, false), MaxMinFair).Match(suppliers, buyers, affinity)
+
+	if got := sumAmount(matches["b2"]); got != 20 {
+		t.Errorf("Expected b2 to get 20, got %d", got)
+	}
+	if got := sumAmount(matches["b1"]); got != 40 {
+		t.Errorf("Expected b1 to get 40, got %d", got)
+	}
+}
+
+// 3. 目标计算
+func TestFairTargets(t *testing.T) {
+	tests := []struct {
+		mode     string
+		needs    []int64
+		total    int64
+		expected []int64
+	}{
+		{MaxMinFair, []int64{10, 50, 50}, 70, []int64{10, 30, 30}},
+		{MaxMinFair, []int64{10, 50, 50}, 71, []int64{10, 31, 30}},
+		{ProportionalFair, []int64{10, 50, 40}, 50, []int64{5, 25, 20}},
+		{ProportionalFair, []int64{1, 1, 1}, 2, []int64{1, 1, 0}},
+		{MaxMinFair, []int64{10, 20}, 30, nil},
+	}
+	for _, tt := range tests {
+		if targets := fairTargets(tt.mode, tt.needs, tt.total); !reflect.DeepEqual(targets, tt.expected) {
+			t.Errorf("%s %v %d: expected %v, got %v", tt.mode, tt.needs, tt.total, tt.expected, targets)
+		}
+	}
+}
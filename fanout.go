@@ -0,0 +1,18 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+// canServe returns whether the supplier can be sold to a buyer, recorded is whether
+// the buyer has bought from it already, see Supplier.MaxBuyers.
+func canServe(supplier *Supplier, recorded bool) bool {
+	return supplier.MaxBuyers <= 0 || recorded || supplier.BuyersRest > 0
+}
+
+// takeBuyer reduces the BuyersRest of the supplier when it is sold to a new buyer.
+func takeBuyer(supplier *Supplier) {
+	if supplier.MaxBuyers > 0 {
+		supplier.BuyersRest--
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"testing"
+)
+
+func makeFanoutSupplier(id string, cap int64, maxBuyers int) Supplier {
+	s := makeSupplier(id, cap, 1, nil)
+	s.MaxBuyers = maxBuyers
+	s.BuyersRest = maxBuyers
+	return s
+}
+
+// 1. 所有匹配器都遵守供应商的最大买家数
+func TestMatchers_MaxBuyers(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		// s1 便宜但只能服务一个买家；s2 更贵但不限
+		suppliers := []Supplier{
+			makeFanoutSupplier("s1", 100, 1),
+			makeFanoutSupplier("s2", 100, 0),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 30, nil),
+			makeBuyer("b2", 30, nil),
+			makeBuyer("b3", 30, nil),
+		}
+		affinity := newMockAffinityTable()
+		for _, b := range buyers {
+			affinity.setPrice("s1", b.ID, 10.0)
+			affinity.setPrice("s2", b.ID, 30.0)
+		}
+		return suppliers, buyers, affinity
+	}
+
+	for name, m := range map[string]Matcher{
+		"Greedy":    GreedyMatcher(1.0, 0.0, 0, false, false),
+		"MinCost":   MinCostMatcher(false),
+		"Exclusive": ExclusiveMatcher(false),
+		"Fair":      FairMatcher(GreedyMatcher(1.0, 0.0, 0, false, false), MaxMinFair),
+	} {
+		t.Run(name, func(t *testing.T) {
+			suppliers, buyers, affinity := newCase()
+			original := append([]Supplier(nil), suppliers...)
+			matches, _ := m.Match(suppliers, buyers, affinity)
+
+			if vs := Verify(original, buyers, affinity, matches, name == "Exclusive"); vs != nil {
+				t.Errorf("Unexpected violations: %v", vs)
+			}
+
+			served := 0
+			for _, records := range matches {
+				for _, record := range records {
+					if record.SupplierID == "s1" {
+						served++
+					}
+				}
+			}
+			if served != 1 {
+				t.Errorf("Expected s1 to serve 1 buyer, got %d: %v", served, matches)
+			}
+			if suppliers[0].BuyersRest != 0 {
+				t.Errorf("Expected s1 BuyersRest 0, got %d", suppliers[0].BuyersRest)
+			}
+			if name != "Exclusive" && sumRecords(matches["b1"])+sumRecords(matches["b2"])+sumRecords(matches["b3"]) < 90 {
+				t.Errorf("Expected all demands met, got %v", matches)
+			}
+		})
+	}
+}
+
+// 2. 最小费用流在买家数受限时仍保留流量最大的买家
+func TestMinCostMatcher_MaxBuyers(t *testing.T) {
+	suppliers := []Supplier{
+		makeFanoutSupplier("s1", 100, 2),
+		makeFanoutSupplier("s2", 100, 0),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 50, nil),
+		makeBuyer("b2", 30, nil),
+		makeBuyer("b3", 10, nil),
+	}
+	affinity := newMockAffinityTable()
+	for _, b := range buyers {
+		affinity.setPrice("s1", b.ID, 10.0)
+		affinity.setPrice("s2", b.ID, 30.0)
+	}
+
+	matches, perfect := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+
+	if !perfect {
+		t.Fatalf("Expected perfect match, got %v", matches)
+	}
+	if records := matches["b3"]; len(records) != 1 || records[0].SupplierID != "s2" {
+		t.Errorf("Expected b3 to buy from s2 only, got %v", records)
+	}
+	if suppliers[0].CapRest != 20 {
+		t.Errorf("Expected 80 bought from s1, got %d", 100-suppliers[0].CapRest)
+	}
+}
+
+// 3. 校验超出最大买家数
+func TestVerify_OverBuyers(t *testing.T) {
+	suppliers := []Supplier{makeFanoutSupplier("s1", 100, 1)}
+	buyers := []Buyer{makeBuyer("b1", 10, nil), makeBuyer("b2", 10, nil)}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s1", "b2", 10.0)
+
+	matches := Matches{
+		"b1": {{"s1", 10}},
+		"b2": {{"s1", 10}},
+	}
+	vs := Verify(suppliers, buyers, affinity, matches, false)
+	if len(vs) != 1 || vs[0].Kind != ViolationOverBuyers || vs[0].BuyerID != "b2" {
+		t.Errorf("Expected b2 over buyers, got %v", vs)
+	}
+}
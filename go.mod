@@ -2,4 +2,7 @@ module github.com/someonegg/rsdmatch
 
 go 1.15
 
-require github.com/urfave/cli/v2 v2.23.5
+require (
+	github.com/urfave/cli/v2 v2.23.5
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -5,10 +5,12 @@
 package rsdmatch
 
 import (
-	"fmt"
+	"context"
+	"encoding/binary"
+	"hash/fnv"
 	"math"
+	"math/bits"
 	"sort"
-	"unsafe"
 )
 
 type greedyMatcher struct {
@@ -17,6 +19,49 @@ type greedyMatcher struct {
 	enough    int
 	exclusive bool
 	verbose   bool
+	minAmount int64
+	step      int64
+	shuffle   bool
+	seed      int64
+	remainder bool
+}
+
+// GreedyOption configures NewGreedyMatcher, see GreedyMatcher for the first fields.
+type GreedyOption struct {
+	Sensitivity float32 `json:"sens"`
+	Bottom      float32 `json:"bottom"`
+	Enough      int     `json:"enough"`
+	Exclusive   bool    `json:"exclusive"`
+	Verbose     bool    `json:"verbose"`
+
+	// The minimum amount of a new BuyRecord (or the rest of the demand, if smaller),
+	// a proportional share below it is raised to it when the supplier can afford,
+	// otherwise dropped and left to the other suppliers. No minimum when <= 1.
+	MinAmount int64 `json:"min_amount"`
+
+	// The granularity of the proportional shares, they are rounded up to multiples of
+	// Step, unless limited by the BuyLimit or capacity. No granularity when <= 1.
+	Step int64 `json:"step"`
+
+	// Shuffle the suppliers with the same price tier and priority for each buyer by
+	// Seed, instead of ordering them by ID, so the load spreads evenly over them. The
+	// order only depends on Seed and the IDs, so it is reproducible.
+	Shuffle bool  `json:"shuffle"`
+	Seed    int64 `json:"seed"`
+
+	// Divide the demand of a buyer over the suppliers of a price tier in exact proportion
+	// to amount × priority, the integer remainder goes to the largest fractional parts,
+	// instead of rounding each share up in order, which favors the first suppliers. A
+	// supplier that gets nothing still gets 1 while the buyer has fewer than Enough
+	// suppliers. MinAmount and Step still apply to the shares.
+	LargestRemainder bool `json:"largest_remainder"`
+}
+
+// NewGreedyMatcher creates a greedy matching algorithm with the option, MinAmount and
+// Step are not used in exclusive mode.
+func NewGreedyMatcher(o GreedyOption) Matcher {
+	return greedyMatcher{o.Sensitivity, o.Bottom, o.Enough, o.Exclusive, o.Verbose, o.MinAmount, o.Step,
+		o.Shuffle, o.Seed, o.LargestRemainder}
 }
 
 // GreedyMatcher creates a greedy matching algorithm that matches buyers to suppliers
@@ -40,7 +85,8 @@ type greedyMatcher struct {
 //     or none at all. This ensures each supplier serves at most one buyer.
 //     Suppliers with partial remaining capacity (CapRest < Cap) are rejected.
 //
-//   - verbose: Enable detailed logging of matching process.
+//   - verbose: Enable detailed logging of matching process to stdout, when the
+//     context passed to MatchContext carries no Tracer.
 //
 // Matching strategy:
 //   1. Sort all (supplier, buyer) pairs by: price tier → buyer → supplier priority
@@ -48,7 +94,13 @@ type greedyMatcher struct {
 //      by priority (non-exclusive) or exclusively (full capacity only)
 //   3. Stop matching a buyer when: demand satisfied + enough suppliers + price > bottom
 func GreedyMatcher(priceSensitivity, priceBottom float32, enoughSupplierCount int, exclusive, verbose bool) Matcher {
-	return greedyMatcher{priceSensitivity, priceBottom, enoughSupplierCount, exclusive, verbose}
+	return NewGreedyMatcher(GreedyOption{
+		Sensitivity: priceSensitivity,
+		Bottom:      priceBottom,
+		Enough:      enoughSupplierCount,
+		Exclusive:   exclusive,
+		Verbose:     verbose,
+	})
 }
 
 type greedyAffinity struct {
@@ -57,6 +109,7 @@ type greedyAffinity struct {
 
 	price float32
 	limit int64
+	key   uint64 // the shuffle key, see GreedyOption.Shuffle
 }
 
 // sensCompare compares two prices by grouping them into tiers.
@@ -69,60 +122,122 @@ func (m greedyMatcher) sensCompare(a, b float32) int {
 	return iA - iB
 }
 
-// ptrCompare compares two pointers by their memory address.
-// Used to ensure deterministic ordering of buyers when prices are equal.
-// Since pointers are stable within a single execution, this provides
-// consistent ordering across multiple runs with the same input.
-func (m greedyMatcher) ptrCompare(a, b unsafe.Pointer) int {
-	if uintptr(a) < uintptr(b) {
-		return -1
+// minimum returns the minimum amount of a new record of the buyer.
+func (m greedyMatcher) minimum(buyer *Buyer) int64 {
+	if m.minAmount <= 1 {
+		return 0
 	}
-	if uintptr(a) > uintptr(b) {
-		return 1
+	if buyer.DemandRest > 0 {
+		return minInt64(m.minAmount, buyer.DemandRest)
 	}
-	return 0
+	return m.minAmount
 }
 
-func (m greedyMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool) {
-	al := make([]greedyAffinity, len(suppliers)*len(buyers))
-
-	for n, i := 0, 0; i < len(suppliers); i++ {
-		for j := 0; j < len(buyers); j++ {
-			a := affinities.Find(&suppliers[i], &buyers[j])
-			al[n] = greedyAffinity{
-				supplier: &suppliers[i],
-				buyer:    &buyers[j],
-				price:    a.Price,
-				limit:    math.MaxInt64,
-			}
-			if a.Limit != nil {
-				al[n].limit = a.Limit.Calculate(suppliers[i].Cap, buyers[j].Demand)
-			}
-			n++
+// shuffleKey returns the shuffle key of the (supplier, buyer) pair, or 0 when not
+// shuffled.
+func (m greedyMatcher) shuffleKey(supplier *Supplier, buyer *Buyer) uint64 {
+	if !m.shuffle {
+		return 0
+	}
+	h := fnv.New64a()
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(m.seed))
+	h.Write(seed[:])
+	h.Write([]byte(buyer.ID))
+	h.Write([]byte{0})
+	h.Write([]byte(supplier.ID))
+
+	// The finalizer of MurmurHash3, to spread the close IDs.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// recordIndex returns the index of the supplier's record, or -1.
+func recordIndex(records []BuyRecord, supplierID string) int {
+	for k := range records {
+		if records[k].SupplierID == supplierID {
+			return k
 		}
 	}
+	return -1
+}
+
+// tier returns the price tier used by sensCompare.
+func (m greedyMatcher) tier(price float32) int {
+	return int(price / m.sens)
+}
+
+func (m greedyMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool) {
+	matches, perfect, _ = m.MatchContext(context.Background(), suppliers, buyers, affinities)
+	return
+}
+
+func (m greedyMatcher) MatchContext(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool, err error) {
+	matches = make(Matches, len(buyers))
+	tracer := contextTracer(ctx, m.verbose)
+	detail := tracesDetail(tracer)
+	domains := newDomainUsage(ctx, suppliers)
+
+	// Pairs with a zero limit can never be allocated, so they are not collected.
+	var al []greedyAffinity
+
+	err = findAffinities(ctx, suppliers, buyers, affinities, func(i, j int, price float32, limit int64) {
+		al = append(al, greedyAffinity{
+			supplier: &suppliers[i],
+			buyer:    &buyers[j],
+			price:    price,
+			limit:    limit,
+			key:      m.shuffleKey(&suppliers[i], &buyers[j]),
+		})
+	})
+	if err != nil {
+		return
+	}
 
 	// Sort all (supplier, buyer) pairs by priority:
 	// 1. Price tier (lower is better): uses sensCompare to group prices
-	// 2. Buyer (for determinism): uses pointer address for consistent ordering
-	// 3. Supplier priority (higher is better): within same price tier and buyer,
-	//    higher priority suppliers come first
+	// 2. Buyer (for determinism): uses BuyerLess, higher priority and larger demand first
+	// 3. Supplier (higher priority is better): within same price tier and buyer,
+	//    higher priority suppliers come first, then by the shuffle key when shuffled,
+	//    then by ID
 	// This ensures we process cheapest suppliers first, and within same price,
-	// prefer higher priority suppliers.
-	sort.SliceStable(al, func(i, j int) bool {
-		r1 := m.sensCompare(al[i].price, al[j].price)
-		r2 := m.ptrCompare(unsafe.Pointer(al[i].buyer), unsafe.Pointer(al[j].buyer))
-		return r1 < 0 ||
-			r1 == 0 && r2 < 0 ||
-			r1 == 0 && r2 == 0 &&
-				al[i].supplier.Priority > al[j].supplier.Priority
+	// prefer higher priority suppliers. The order only depends on the keys, not on
+	// the order of the input slices.
+	sort.Slice(al, func(i, j int) bool {
+		if r := m.sensCompare(al[i].price, al[j].price); r != 0 {
+			return r < 0
+		}
+		if al[i].buyer != al[j].buyer {
+			return BuyerLess(al[i].buyer, al[j].buyer)
+		}
+		if al[i].supplier.Priority == al[j].supplier.Priority && al[i].key != al[j].key {
+			return al[i].key < al[j].key
+		}
+		return supplierLess(al[i].supplier, al[j].supplier)
 	})
 
-	matches = make(Matches, len(buyers))
+	// Buyers whose BuyerStopped event is traced, and the prices of their last allocations.
+	stopped := make(map[*Buyer]bool)
+	lastPrice := make(map[*Buyer]float32)
+	stop := func(buyer *Buyer, price float32, reason string) {
+		if tracer != nil && !stopped[buyer] {
+			stopped[buyer] = true
+			tracer.Trace(BuyerStopped{buyer.ID, price, reason})
+		}
+	}
 
 	// Process affinity list in chunks grouped by (price tier, buyer)
 	// Each chunk represents: all suppliers for a specific buyer at a specific price tier
 	for start, end := 0, 0; start < len(al); start = end {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
 		buyer := al[start].buyer
 
 		// Find the end of current group: same price tier AND same buyer
@@ -137,11 +252,16 @@ func (m greedyMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities Af
 		// Calculate total available capacity and weighted priority sum for this group
 		available := int64(0)   // Total capacity all suppliers in this group can provide
 		factorSum := int64(0)   // Sum of (capacity × priority) for proportional allocation
+		amounts := make([]int64, end-start)
 		for i := start; i < end; i++ {
-			amount := minInt64(al[i].limit, al[i].supplier.CapRest)
+			amount := minInt64(buyable(al[i].supplier, buyer, al[i].limit), domains.limit(al[i].supplier, buyer))
+			if !canServe(al[i].supplier, recordIndex(matches[buyer.ID], al[i].supplier.ID) >= 0) {
+				amount = 0
+			}
 			factor := amount * al[i].supplier.Priority
 			available += amount
 			factorSum += factor
+			amounts[i-start] = amount
 		}
 
 		demandRest := buyer.DemandRest
@@ -153,14 +273,35 @@ func (m greedyMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities Af
 			demandRest = 1
 		}
 
-		if demandRest <= 0 || available <= 0 || factorSum <= 0 {
+		if demandRest <= 0 {
+			stop(buyer, lastPrice[buyer], StopSatisfied)
+			continue
+		}
+		if available <= 0 || factorSum <= 0 {
+			if detail {
+				for i := start; i < end; i++ {
+					tracer.Trace(Considered{buyer.ID, al[i].supplier.ID, al[i].price, m.tier(al[i].price),
+						al[i].limit, al[i].supplier.CapRest, buyer.DemandRest, 0, SkipZeroAmount})
+				}
+			}
 			continue
 		}
 
-		if m.verbose {
-			fmt.Println(buyer.ID,
-				"demand:", buyer.Demand, "demand_rest:", demandRest,
-				"available:", available, "factor_sum:", factorSum)
+		var shares []int64
+		if m.remainder && !m.exclusive {
+			shares = m.apportion(al[start:end], amounts, demandRest, len(matches[buyer.ID]))
+		}
+
+		if tracer != nil {
+			tracer.Trace(TierStarted{
+				BuyerID:    buyer.ID,
+				Tier:       m.tier(al[start].price),
+				Price:      al[start].price,
+				Demand:     buyer.Demand,
+				DemandRest: demandRest,
+				Available:  available,
+				FactorSum:  factorSum,
+			})
 		}
 
 		for i := start; i < end; i++ {
@@ -169,15 +310,43 @@ func (m greedyMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities Af
 			}
 
 			supplier := al[i].supplier
+			records := matches[buyer.ID]
+			recorded := recordIndex(records, supplier.ID) >= 0
+			dropped := false
+
 			// Calculate maximum amount this supplier can provide
-			// Limited by both: BuyLimit (if set) and remaining capacity
-			amount := minInt64(al[i].limit, al[i].supplier.CapRest)
+			// Limited by: BuyLimit (if set), remaining capacity, extra capacities, the
+			// max number of buyers and the rest of the domain
+			amount := buyable(supplier, buyer, al[i].limit)
+			served := canServe(supplier, recorded)
+			if !served {
+				amount = 0
+			}
+			domainRest := domains.limit(supplier, buyer)
+			amount = minInt64(amount, domainRest)
 			factor := amount * al[i].supplier.Priority
 
 			// Non-exclusive mode: allocate proportionally by priority
 			if !m.exclusive {
-				may := math.Ceil(float64(factor) / float64(factorSum) * float64(demandRest))
-				amount = minInt64(int64(may), amount)
+				var may int64
+				if shares != nil {
+					may = shares[i-start]
+				} else {
+					may = int64(math.Ceil(float64(factor) / float64(factorSum) * float64(demandRest)))
+				}
+				if m.step > 1 {
+					may = (may + m.step - 1) / m.step * m.step
+				}
+				// A share below the minimum is raised, or dropped (amount < minimum) and
+				// consolidated into the shares of the following suppliers.
+				minimum := m.minimum(buyer)
+				if !recorded && may > 0 && may < minimum {
+					may = minimum
+				}
+				amount = minInt64(may, amount)
+				if !recorded && amount > 0 && amount < minimum {
+					amount, dropped = 0, true
+				}
 			}
 			factorSum -= factor
 
@@ -187,30 +356,45 @@ func (m greedyMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities Af
 			//    - Supplier has been partially allocated to other buyers (CapRest < Cap)
 			//    - Or BuyLimit prevents taking full capacity
 			// In exclusive mode, buyer must either take entire supplier or none
-			if amount <= 0 || (m.exclusive && amount != supplier.Cap) {
+			skipped := ""
+			switch {
+			case !served:
+				skipped = SkipMaxBuyers
+			case domainRest <= 0:
+				skipped = SkipDomain
+			case dropped:
+				skipped = SkipBelowMinimum
+			case amount <= 0:
+				skipped = SkipZeroAmount
+			case m.exclusive && amount != supplier.Cap:
+				skipped = SkipNotWhole
+			}
+			if detail {
+				tracer.Trace(Considered{buyer.ID, supplier.ID, al[i].price, m.tier(al[i].price),
+					al[i].limit, supplier.CapRest, buyer.DemandRest, amount, skipped})
+			}
+			if skipped != "" {
 				continue
 			}
 
-			records, recorded := matches[buyer.ID], false
-			for i := 0; i < len(records); i++ {
-				if records[i].SupplierID == supplier.ID {
-					recorded = true
-					records[i].Amount += amount
-					break
-				}
-			}
-			if !recorded {
+			if k := recordIndex(records, supplier.ID); k >= 0 {
+				records[k].Amount += amount
+			} else {
 				records = append(records, BuyRecord{supplier.ID, amount})
+				takeBuyer(supplier)
 			}
 			matches[buyer.ID] = records
+			lastPrice[buyer] = al[i].price
 
-			if m.verbose {
-				fmt.Println("  ", al[i].price, al[i].supplier.Info, amount, factor)
+			if tracer != nil {
+				tracer.Trace(Allocated{buyer.ID, supplier.ID, al[i].price, amount})
 			}
 
 			supplier.CapRest -= amount
 			buyer.DemandRest -= amount
 			demandRest -= amount
+			takeExtra(supplier, buyer, amount)
+			domains.take(supplier, buyer, amount)
 
 			// Stop matching this buyer when ALL of these conditions are met:
 			// 1. demandRest <= 0: remaining demand for this price tier is satisfied
@@ -222,6 +406,7 @@ func (m greedyMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities Af
 			// This ensures we don't continue to higher price tiers unnecessarily.
 			if demandRest <= 0 && len(matches[buyer.ID]) >= m.enough &&
 				(m.exclusive || m.sensCompare(al[i].price, m.bottom) > 0) {
+				stop(buyer, al[i].price, StopSatisfied)
 				break
 			}
 			// Ensure demandRest stays at least 1 to allow continued matching
@@ -238,13 +423,114 @@ func (m greedyMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities Af
 		}
 		if done {
 			perfect = true
-			return
+			break
 		}
 	}
 
+	if tracer != nil {
+		reason := StopExhausted
+		if perfect {
+			reason = StopPerfect
+		}
+		for _, j := range buyerOrder(buyers) {
+			stop(&buyers[j], 0, reason)
+		}
+	}
 	return
 }
 
+// apportion divides total over the group in proportion to amount × priority, the
+// shares are limited by the amounts, and the remainder goes to the largest fractional
+// parts (the first ones on tie). Then a supplier without share gets 1 in order while
+// fewer than enough suppliers are matched, counting the matched ones.
+func (m greedyMatcher) apportion(group []greedyAffinity, amounts []int64, total int64, matched int) []int64 {
+	shares := make([]int64, len(group))
+	remainders := make([]uint64, len(group))
+	capped := make([]bool, len(group))
+
+	factor := func(k int) uint64 {
+		if amounts[k] <= 0 || group[k].supplier.Priority <= 0 {
+			return 0
+		}
+		return uint64(amounts[k]) * uint64(group[k].supplier.Priority)
+	}
+
+	// The shares reaching the amounts are capped, and the rest is divided again over
+	// the others.
+	rest := total
+	for {
+		factorSum := uint64(0)
+		for k := range group {
+			if !capped[k] {
+				factorSum += factor(k)
+			}
+		}
+		if factorSum == 0 {
+			break
+		}
+
+		more := false
+		for k := range group {
+			if capped[k] {
+				continue
+			}
+			hi, lo := bits.Mul64(factor(k), uint64(rest))
+			if hi >= factorSum {
+				shares[k], capped[k], more = amounts[k], true, true
+				continue
+			}
+			q, r := bits.Div64(hi, lo, factorSum)
+			if q >= uint64(amounts[k]) {
+				shares[k], capped[k], more = amounts[k], true, true
+				continue
+			}
+			shares[k], remainders[k] = int64(q), r
+		}
+		if !more {
+			break
+		}
+		rest = total
+		for k := range group {
+			if capped[k] {
+				rest -= shares[k]
+			}
+		}
+	}
+
+	var order []int
+	for k := range group {
+		if !capped[k] {
+			rest -= shares[k]
+			order = append(order, k)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+	for _, k := range order {
+		if rest <= 0 {
+			break
+		}
+		if remainders[k] > 0 {
+			shares[k]++
+			rest--
+		}
+	}
+
+	for k := range group {
+		if shares[k] > 0 {
+			matched++
+		}
+	}
+	for k := 0; k < len(group) && matched < m.enough; k++ {
+		if shares[k] == 0 && amounts[k] > 0 {
+			shares[k] = 1
+			matched++
+		}
+	}
+	return shares
+}
+
 func minInt64(a, b int64) int64 {
 	if a < b {
 		return a
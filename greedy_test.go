@@ -5,6 +5,8 @@
 package rsdmatch
 
 import (
+	"context"
+	"reflect"
 	"testing"
 )
 
@@ -930,3 +932,268 @@ func TestGreedyMatcher_Invariants(t *testing.T) {
 		}
 	})
 }
+
+// countdownContext 在 Err 被调用 n 次之后返回 context.Canceled
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+// 13. Context 取消测试
+func TestGreedyMatcher_Context(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+			makeSupplier("s2", 100, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 100, nil),
+			makeBuyer("b2", 100, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b2", 10.0)
+		return suppliers, buyers, affinity
+	}
+
+	t.Run("Canceled", func(t *testing.T) {
+		suppliers, buyers, affinity := newCase()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		matches, perfect, err := MatchContext(ctx, GreedyMatcher(1.0, 0.0, 0, false, false), suppliers, buyers, affinity)
+
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if perfect || len(matches) != 0 {
+			t.Errorf("Expected no matches, got %v", matches)
+		}
+		if suppliers[0].CapRest != 100 || suppliers[1].CapRest != 100 {
+			t.Error("Expected suppliers untouched")
+		}
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		suppliers, buyers, affinity := newCase()
+		// 收集阶段检查 2 次，然后只允许处理第一个分组
+		ctx := &countdownContext{context.Background(), 3}
+
+		matches, perfect, err := MatchContext(ctx, GreedyMatcher(1.0, 0.0, 0, false, false), suppliers, buyers, affinity)
+
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if perfect {
+			t.Error("Expected non-perfect match")
+		}
+		if len(matches["b1"]) != 1 || len(matches["b2"]) != 0 {
+			t.Errorf("Expected only b1 to be matched, got %v", matches)
+		}
+		if buyers[0].DemandRest != 0 || buyers[1].DemandRest != 100 {
+			t.Error("Expected DemandRest consistent with the partial matches")
+		}
+	})
+
+	t.Run("NotCanceled", func(t *testing.T) {
+		suppliers, buyers, affinity := newCase()
+
+		_, perfect, err := MatchContext(context.Background(), GreedyMatcher(1.0, 0.0, 0, false, false), suppliers, buyers, affinity)
+
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if !perfect {
+			t.Error("Expected perfect match")
+		}
+	})
+}
+
+// 14. 最小分配量与粒度测试
+func TestGreedyMatcher_MinAmountStep(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		var suppliers []Supplier
+		affinity := newMockAffinityTable()
+		for i := 0; i < 10; i++ {
+			id := string(rune('a' + i))
+			suppliers = append(suppliers, makeSupplier(id, 100, 1, nil))
+			affinity.setPrice(id, "b1", 10.0)
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 10, nil),
+		}
+		return suppliers, buyers, affinity
+	}
+
+	amounts := func(records []BuyRecord) []int64 {
+		var as []int64
+		for _, record := range records {
+			as = append(as, record.Amount)
+		}
+		return as
+	}
+
+	tests := []struct {
+		name     string
+		option   GreedyOption
+		expected []int64
+	}{
+		{"Default", GreedyOption{Sensitivity: 1.0}, []int64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{"MinAmount", GreedyOption{Sensitivity: 1.0, MinAmount: 4}, []int64{4, 4, 2}},
+		{"Step", GreedyOption{Sensitivity: 1.0, Step: 5}, []int64{5, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suppliers, buyers, affinity := newCase()
+			matches, perfect := NewGreedyMatcher(tt.option).Match(suppliers, buyers, affinity)
+			if !perfect {
+				t.Error("Expected perfect match")
+			}
+			if got := amounts(matches["b1"]); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected amounts %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("Dropped", func(t *testing.T) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 2, 1, nil),
+			makeSupplier("s2", 100, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 10, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b1", 10.0)
+
+		matches, _ := NewGreedyMatcher(GreedyOption{Sensitivity: 1.0, MinAmount: 4}).Match(suppliers, buyers, affinity)
+
+		if len(matches["b1"]) != 1 || matches["b1"][0] != (BuyRecord{"s2", 10}) {
+			t.Errorf("Expected s1 dropped and consolidated into s2, got %v", matches["b1"])
+		}
+	})
+}
+
+// 15. 同价同优先级供应商的随机打散测试
+func TestGreedyMatcher_Shuffle(t *testing.T) {
+	newCase := func(reversed bool) ([]Supplier, []Buyer, AffinityTable) {
+		affinity := newMockAffinityTable()
+		var suppliers []Supplier
+		var buyers []Buyer
+		for i := 0; i < 10; i++ {
+			id := string(rune('a' + i))
+			suppliers = append(suppliers, makeSupplier(id, 100, 1, nil))
+			buyers = append(buyers, makeBuyer("b"+id, 1, nil))
+		}
+		for _, s := range suppliers {
+			for _, b := range buyers {
+				affinity.setPrice(s.ID, b.ID, 10.0)
+			}
+		}
+		if reversed {
+			for i, j := 0, len(suppliers)-1; i < j; i, j = i+1, j-1 {
+				suppliers[i], suppliers[j] = suppliers[j], suppliers[i]
+				buyers[i], buyers[j] = buyers[j], buyers[i]
+			}
+		}
+		return suppliers, buyers, affinity
+	}
+
+	used := func(matches Matches) int {
+		suppliers := make(map[string]bool)
+		for _, records := range matches {
+			for _, record := range records {
+				suppliers[record.SupplierID] = true
+			}
+		}
+		return len(suppliers)
+	}
+
+	// 不打散时所有买家都选择 ID 最小的供应商
+	matches, _ := NewGreedyMatcher(GreedyOption{Sensitivity: 1.0}).Match(newCase(false))
+	if n := used(matches); n != 1 {
+		t.Errorf("Expected 1 supplier used without shuffle, got %d", n)
+	}
+
+	o := GreedyOption{Sensitivity: 1.0, Shuffle: true, Seed: 42}
+	matches, _ = NewGreedyMatcher(o).Match(newCase(false))
+	if n := used(matches); n < 4 {
+		t.Errorf("Expected the load spread over suppliers, got %d used", n)
+	}
+
+	// 相同种子的结果可复现，且与输入顺序无关
+	again, _ := NewGreedyMatcher(o).Match(newCase(true))
+	if !reflect.DeepEqual(matches, again) {
+		t.Errorf("Expected reproducible matches, got %v and %v", matches, again)
+	}
+
+	o.Seed = 7
+	other, _ := NewGreedyMatcher(o).Match(newCase(false))
+	if reflect.DeepEqual(matches, other) {
+		t.Errorf("Expected different matches with another seed, got %v", other)
+	}
+}
+
+// 16. 最大余数法按优先级精确分配测试
+func TestGreedyMatcher_LargestRemainder(t *testing.T) {
+	run := func(o GreedyOption, priorities []int64, demand int64) []int64 {
+		affinity := newMockAffinityTable()
+		var suppliers []Supplier
+		for i, priority := range priorities {
+			id := string(rune('a' + i))
+			suppliers = append(suppliers, makeSupplier(id, 100, priority, nil))
+			affinity.setPrice(id, "b", 10.0)
+		}
+		buyers := []Buyer{makeBuyer("b", demand, nil)}
+		matches, _ := NewGreedyMatcher(o).Match(suppliers, buyers, affinity)
+
+		amounts := make([]int64, len(suppliers))
+		for _, record := range matches["b"] {
+			amounts[record.SupplierID[0]-'a'] = record.Amount
+		}
+		return amounts
+	}
+
+	o := GreedyOption{Sensitivity: 1.0, Bottom: 100.0}
+
+	// 向上取整时靠前的供应商多分
+	if got := run(o, []int64{2, 1}, 5); !reflect.DeepEqual(got, []int64{4, 1}) {
+		t.Errorf("Expected [4 1] with ceil, got %v", got)
+	}
+	if got := run(o, []int64{1, 1, 1}, 1); !reflect.DeepEqual(got, []int64{1, 1, 1}) {
+		t.Errorf("Expected [1 1 1] with ceil, got %v", got)
+	}
+
+	o.LargestRemainder = true
+
+	// 余数按小数部分从大到小分配
+	if got := run(o, []int64{2, 1}, 5); !reflect.DeepEqual(got, []int64{3, 2}) {
+		t.Errorf("Expected [3 2], got %v", got)
+	}
+	if got := run(o, []int64{3, 2, 1}, 60); !reflect.DeepEqual(got, []int64{30, 20, 10}) {
+		t.Errorf("Expected [30 20 10], got %v", got)
+	}
+	if got := run(o, []int64{1, 1, 1}, 1); !reflect.DeepEqual(got, []int64{1, 0, 0}) {
+		t.Errorf("Expected [1 0 0], got %v", got)
+	}
+
+	// 容量不足时全部用完
+	if got := run(o, []int64{2, 1}, 500); !reflect.DeepEqual(got, []int64{100, 100}) {
+		t.Errorf("Expected [100 100], got %v", got)
+	}
+
+	// 未达到足够供应商数时补 1
+	o.Enough = 2
+	if got := run(o, []int64{1, 1, 1}, 1); !reflect.DeepEqual(got, []int64{1, 1, 0}) {
+		t.Errorf("Expected [1 1 0] with enough 2, got %v", got)
+	}
+}
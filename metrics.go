@@ -0,0 +1,172 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"math"
+	"sort"
+)
+
+// Metrics describes the quality of matches, see ComputeMetrics.
+type Metrics struct {
+	Demand   int64   `json:"demand"`    // the total demand of the buyers
+	Matched  int64   `json:"matched"`   // the total amount bought
+	Cost     float64 `json:"cost"`      // the total price-weighted amount
+	AvgPrice float64 `json:"avg_price"` // Cost / Matched
+
+	// The ratio of the demand met, the amount a buyer bought beyond its demand is
+	// not counted.
+	Coverage float64 `json:"coverage"`
+
+	// The amount bought / Demand of each buyer (by ID) with a positive demand, it is
+	// greater than 1.0 when the buyer bought more than its demand.
+	Fill map[string]float64 `json:"fill"`
+
+	// The amounts bought in the price bands.
+	Bands []Band `json:"bands"`
+
+	// The Herfindahl index (0.0-1.0] of the suppliers' shares of Matched, and the
+	// amount-weighted mean of the Herfindahl indexes of the buyers' allocations over
+	// their suppliers. Higher is more concentrated.
+	SupplierHHI float64 `json:"supplier_hhi"`
+	BuyerHHI    float64 `json:"buyer_hhi"`
+
+	// The distribution of the ratio sold / Cap of the suppliers with a positive Cap.
+	Utilization Distribution `json:"utilization"`
+}
+
+// Band is a price band, the prices in [the Below of the previous band, Below).
+type Band struct {
+	Below  float32 `json:"below"` // math.MaxFloat32 for the last band
+	Amount int64   `json:"amount"`
+	Share  float64 `json:"share"` // Amount / Metrics.Demand
+}
+
+// Distribution summarizes a distribution of values.
+type Distribution struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	Max  float64 `json:"max"`
+}
+
+// ComputeMetrics computes the metrics of matches against the original suppliers and
+// buyers (their Cap and Demand), the prices are found by affinities. The bands are
+// the ascending bounds between the price bands, so there are len(bands)+1 bands.
+// The records of unknown buyers or suppliers are ignored.
+func ComputeMetrics(suppliers []Supplier, buyers []Buyer, affinities AffinityTable, matches Matches, bands ...float32) Metrics {
+	var x Metrics
+
+	x.Bands = make([]Band, len(bands)+1)
+	for k, below := range bands {
+		x.Bands[k].Below = below
+	}
+	x.Bands[len(bands)].Below = math.MaxFloat32
+
+	supplierIndex := make(map[string]int, len(suppliers))
+	for i := range suppliers {
+		supplierIndex[suppliers[i].ID] = i
+	}
+
+	sold := make([]int64, len(suppliers))
+	buyerHHI := 0.0
+	covered := int64(0)
+	for j := range buyers {
+		buyer := &buyers[j]
+		x.Demand += maxInt64(buyer.Demand, 0)
+
+		bought := int64(0)
+		var amounts []int64
+		for _, record := range matches[buyer.ID] {
+			i, ok := supplierIndex[record.SupplierID]
+			if !ok || record.Amount <= 0 {
+				continue
+			}
+			supplier := &suppliers[i]
+			price := affinities.Find(supplier, buyer).Price
+
+			sold[i] += record.Amount
+			bought += record.Amount
+			amounts = append(amounts, record.Amount)
+			x.Cost += float64(price) * float64(record.Amount)
+
+			k := sort.Search(len(bands), func(k int) bool { return price < bands[k] })
+			x.Bands[k].Amount += record.Amount
+		}
+
+		x.Matched += bought
+		if buyer.Demand > 0 {
+			if x.Fill == nil {
+				x.Fill = make(map[string]float64)
+			}
+			x.Fill[buyer.ID] = float64(bought) / float64(buyer.Demand)
+			covered += minInt64(bought, buyer.Demand)
+		}
+		if bought > 0 {
+			buyerHHI += herfindahl(amounts, bought) * float64(bought)
+		}
+	}
+
+	if x.Matched > 0 {
+		x.AvgPrice = x.Cost / float64(x.Matched)
+		x.SupplierHHI = herfindahl(sold, x.Matched)
+		x.BuyerHHI = buyerHHI / float64(x.Matched)
+	}
+	if x.Demand > 0 {
+		x.Coverage = float64(covered) / float64(x.Demand)
+		for k := range x.Bands {
+			x.Bands[k].Share = float64(x.Bands[k].Amount) / float64(x.Demand)
+		}
+	}
+
+	var utilizations []float64
+	for i := range suppliers {
+		if suppliers[i].Cap > 0 {
+			utilizations = append(utilizations, float64(sold[i])/float64(suppliers[i].Cap))
+		}
+	}
+	x.Utilization = distribute(utilizations)
+
+	return x
+}
+
+// herfindahl returns the sum of the squared shares of the amounts in total.
+func herfindahl(amounts []int64, total int64) float64 {
+	h := 0.0
+	for _, amount := range amounts {
+		share := float64(amount) / float64(total)
+		h += share * share
+	}
+	return h
+}
+
+// distribute summarizes the values, the percentiles are the nearest ranks.
+func distribute(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	rank := func(p float64) float64 {
+		k := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if k < 0 {
+			k = 0
+		}
+		return sorted[k]
+	}
+	return Distribution{
+		Min:  sorted[0],
+		Mean: sum / float64(len(sorted)),
+		P50:  rank(0.5),
+		P90:  rank(0.9),
+		Max:  sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"math"
+	"testing"
+)
+
+// 1. 匹配质量指标
+func TestComputeMetrics(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 100, 1, nil),
+		makeSupplier("s2", 100, 1, nil),
+		makeSupplier("s3", 100, 1, nil),
+		makeSupplier("s4", 0, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 100, nil),
+		makeBuyer("b2", 50, nil),
+		makeBuyer("b3", 0, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 60.0)
+	affinity.setPrice("s3", "b2", 90.0)
+
+	matches := Matches{
+		"b1": {{"s1", 50}, {"s2", 50}},
+		"b2": {{"s3", 25}, {"unknown", 10}},
+	}
+
+	x := ComputeMetrics(suppliers, buyers, affinity, matches, 50.0, 80.0)
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+	if x.Demand != 150 || x.Matched != 125 {
+		t.Errorf("Expected demand 150 and matched 125, got %d and %d", x.Demand, x.Matched)
+	}
+	if cost := 10.0*50 + 60.0*50 + 90.0*25; !near(x.Cost, cost) || !near(x.AvgPrice, cost/125) {
+		t.Errorf("Unexpected cost %v and avg price %v", x.Cost, x.AvgPrice)
+	}
+	if !near(x.Coverage, 125.0/150) {
+		t.Errorf("Unexpected coverage %v", x.Coverage)
+	}
+	if len(x.Fill) != 2 || !near(x.Fill["b1"], 1.0) || !near(x.Fill["b2"], 0.5) {
+		t.Errorf("Unexpected fill %v", x.Fill)
+	}
+
+	if len(x.Bands) != 3 {
+		t.Fatalf("Expected 3 bands, got %v", x.Bands)
+	}
+	for k, want := range []int64{50, 50, 25} {
+		if x.Bands[k].Amount != want || !near(x.Bands[k].Share, float64(want)/150) {
+			t.Errorf("Unexpected band %d: %+v", k, x.Bands[k])
+		}
+	}
+	if x.Bands[2].Below != math.MaxFloat32 {
+		t.Errorf("Expected the last band unbounded, got %v", x.Bands[2].Below)
+	}
+
+	// 供应商份额 0.4, 0.4, 0.2；b1 为 0.5, 0.5，b2 为 1
+	if !near(x.SupplierHHI, 0.16+0.16+0.04) {
+		t.Errorf("Unexpected supplier HHI %v", x.SupplierHHI)
+	}
+	if !near(x.BuyerHHI, (0.5*100+1.0*25)/125) {
+		t.Errorf("Unexpected buyer HHI %v", x.BuyerHHI)
+	}
+
+	// 利用率 0.5, 0.5, 0.25，s4 容量为 0 不计
+	u := x.Utilization
+	if !near(u.Min, 0.25) || !near(u.Max, 0.5) || !near(u.P50, 0.5) || !near(u.P90, 0.5) || !near(u.Mean, 1.25/3) {
+		t.Errorf("Unexpected utilization %+v", u)
+	}
+}
+
+// 2. 空匹配
+func TestComputeMetrics_Empty(t *testing.T) {
+	x := ComputeMetrics(nil, nil, newMockAffinityTable(), nil)
+	if x.Matched != 0 || x.AvgPrice != 0 || x.Coverage != 0 || len(x.Bands) != 1 || x.Utilization != (Distribution{}) {
+		t.Errorf("Unexpected metrics %+v", x)
+	}
+}
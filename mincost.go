@@ -0,0 +1,362 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sort"
+)
+
+type minCostMatcher struct {
+	verbose bool
+}
+
+// MinCostMatcher creates an optimal matching algorithm that solves the supplier/buyer
+// assignment as a min-cost max-flow problem.
+//
+// The flow network is: source → supplier (capacity CapRest) → buyer (capacity
+// BuyLimit, cost Price per unit) → sink (capacity DemandRest). When the buyer limits
+// the domains (see Buyer.MaxDomainShare), the suppliers of a domain go to the buyer
+// through a node of the domain, capped by the domain limit. The result first
+// maximizes the total matched amount, then minimizes the total price-weighted amount.
+//
+// Unlike GreedyMatcher there are no price tiers, price bottom or enough supplier count,
+// and supplier priority is not used. The extra capacities and Supplier.MaxBuyers are
+// respected, but the result may not be optimal when they are binding.
+func MinCostMatcher(verbose bool) Matcher {
+	return minCostMatcher{verbose}
+}
+
+type mincostArc struct {
+	supplier int
+	buyer    int
+	amount   int64 // the rest of the BuyLimit
+	price    float32
+}
+
+type domainKey struct {
+	buyer  int
+	domain string
+}
+
+func (m minCostMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool) {
+	matches, perfect, _ = m.MatchContext(context.Background(), suppliers, buyers, affinities)
+	return
+}
+
+// MatchContext stops between augmenting paths when ctx is done, the flow pushed so far
+// is a valid partial matching but not necessarily the cheapest for its amount.
+func (m minCostMatcher) MatchContext(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool, err error) {
+	ns, nb := len(suppliers), len(buyers)
+	matches = make(Matches, nb)
+	tracer := contextTracer(ctx, m.verbose)
+	domains := newDomainUsage(ctx, suppliers)
+
+	var arcs []mincostArc
+	err = findAffinities(ctx, suppliers, buyers, affinities, func(i, j int, price float32, limit int64) {
+		amount := minInt64(limit, suppliers[i].CapRest)
+		if amount <= 0 || buyers[j].DemandRest <= 0 {
+			return
+		}
+		arcs = append(arcs, mincostArc{i, j, amount, price})
+	})
+	if err != nil {
+		return
+	}
+
+	// Nodes are numbered in the supplierOrder and buyerOrder, and arcs are added in
+	// that order too, so the flow does not depend on the order of the input slices.
+	sorder, border := supplierOrder(suppliers), buyerOrder(buyers)
+	srank, brank := ranks(sorder), ranks(border)
+	sort.Slice(arcs, func(x, y int) bool {
+		if srank[arcs[x].supplier] != srank[arcs[y].supplier] {
+			return srank[arcs[x].supplier] < srank[arcs[y].supplier]
+		}
+		return brank[arcs[x].buyer] < brank[arcs[y].buyer]
+	})
+
+	// The extra capacities (see Buyer.ExtraDemand) are shared by the buyers of a
+	// supplier, which a flow network can not express. So the flow of each arc is
+	// trimmed to fit them, and the flow is solved again for the rest until nothing
+	// is trimmed, the result may not be optimal then. So is Supplier.MaxBuyers, the
+	// arcs of the smallest flows beyond it are banned before the flow is taken.
+	for {
+		source, sink := ns+nb, ns+nb+1
+		g := make(flowGraph, ns+nb+2)
+
+		for r, i := range sorder {
+			if suppliers[i].CapRest > 0 {
+				g.addEdge(source, r, suppliers[i].CapRest, 0)
+			}
+		}
+		for r, j := range border {
+			if buyers[j].DemandRest > 0 {
+				g.addEdge(ns+r, sink, buyers[j].DemandRest, 0)
+			}
+		}
+		// The arcs to a limited domain of a buyer go through a node of the (buyer, domain),
+		// whose edge to the buyer is capped by the rest of the domain.
+		dnodes := make(map[domainKey]int)
+		edges := make([]int, len(arcs))
+		for k, a := range arcs {
+			edges[k] = -1
+			supplier, buyer := &suppliers[a.supplier], &buyers[a.buyer]
+			amount := buyable(supplier, buyer, a.amount)
+			if !canServe(supplier, recordIndex(matches[buyer.ID], supplier.ID) >= 0) {
+				amount = 0
+			}
+			if amount <= 0 {
+				continue
+			}
+			to := ns + brank[a.buyer]
+			if limit := domains.limit(supplier, buyer); limit < math.MaxInt64 {
+				key := domainKey{a.buyer, supplier.Domain}
+				d, ok := dnodes[key]
+				if !ok {
+					d = len(g)
+					g = append(g, nil)
+					g.addEdge(d, to, limit, 0)
+					dnodes[key] = d
+				}
+				to = d
+			}
+			edges[k] = g.addEdge(srank[a.supplier], to, amount, float64(a.price))
+		}
+
+		_, err = g.minCostFlow(ctx, source, sink)
+
+		flows := make([]int64, len(arcs))
+		for k, a := range arcs {
+			if edges[k] >= 0 {
+				e := g[srank[a.supplier]][edges[k]]
+				flows[k] = g[e.to][e.rev].cap // the flow on this edge
+			}
+		}
+		banned := banBuyers(suppliers, buyers, arcs, flows, matches)
+
+		trimmed, allocated := false, false
+		for k := range arcs {
+			a := &arcs[k]
+			flow := flows[k]
+			if flow <= 0 {
+				continue
+			}
+
+			supplier, buyer := &suppliers[a.supplier], &buyers[a.buyer]
+			amount := minInt64(minInt64(flow, extraLimit(supplier, buyer)), domains.limit(supplier, buyer))
+			if amount < flow {
+				trimmed = true
+			}
+			if amount <= 0 {
+				continue
+			}
+			allocated = true
+
+			records := matches[buyer.ID]
+			if k := recordIndex(records, supplier.ID); k >= 0 {
+				records[k].Amount += amount
+			} else {
+				records = append(records, BuyRecord{supplier.ID, amount})
+				takeBuyer(supplier)
+			}
+			matches[buyer.ID] = records
+
+			supplier.CapRest -= amount
+			buyer.DemandRest -= amount
+			takeExtra(supplier, buyer, amount)
+			domains.take(supplier, buyer, amount)
+			a.amount -= amount
+
+			if tracer != nil {
+				tracer.Trace(Allocated{buyer.ID, supplier.ID, a.price, amount})
+			}
+		}
+
+		if err != nil {
+			return
+		}
+		if !banned && (!trimmed || !allocated) {
+			break
+		}
+	}
+
+	perfect = true
+	for j := 0; j < nb; j++ {
+		if buyers[j].DemandRest > 0 {
+			perfect = false
+			break
+		}
+	}
+	return
+}
+
+// banBuyers bans the arcs of the smallest flows to the new buyers of a supplier beyond
+// its BuyersRest, their flows and amounts are set to 0. It returns whether any arc is
+// banned.
+func banBuyers(suppliers []Supplier, buyers []Buyer, arcs []mincostArc, flows []int64, matches Matches) bool {
+	banned := false
+	for start, end := 0, 0; start < len(arcs); start = end {
+		end = start + 1
+		for end < len(arcs) && arcs[end].supplier == arcs[start].supplier {
+			end++
+		}
+		supplier := &suppliers[arcs[start].supplier]
+		if supplier.MaxBuyers <= 0 {
+			continue
+		}
+
+		var news []int
+		for k := start; k < end; k++ {
+			if flows[k] > 0 && recordIndex(matches[buyers[arcs[k].buyer].ID], supplier.ID) < 0 {
+				news = append(news, k)
+			}
+		}
+		if len(news) <= supplier.BuyersRest {
+			continue
+		}
+		sort.SliceStable(news, func(x, y int) bool {
+			return flows[news[x]] > flows[news[y]]
+		})
+		rest := supplier.BuyersRest
+		if rest < 0 {
+			rest = 0
+		}
+		for _, k := range news[rest:] {
+			flows[k], arcs[k].amount = 0, 0
+			banned = true
+		}
+	}
+	return banned
+}
+
+type flowEdge struct {
+	to   int
+	rev  int   // index of the reverse edge in g[to]
+	cap  int64 // residual capacity
+	cost float64
+}
+
+type flowGraph [][]flowEdge
+
+// addEdge adds an edge and its reverse edge, returns the edge index in g[from].
+func (g flowGraph) addEdge(from, to int, cap int64, cost float64) int {
+	g[from] = append(g[from], flowEdge{to, len(g[to]), cap, cost})
+	g[to] = append(g[to], flowEdge{from, len(g[from]) - 1, 0, -cost})
+	return len(g[from]) - 1
+}
+
+const flowEpsilon = 1e-9
+
+// minCostFlow pushes the max flow from s to t with the min cost, using successive
+// shortest paths. Potentials are initialized by Bellman-Ford, so negative costs are
+// allowed, then each shortest path is found by Dijkstra on reduced costs.
+func (g flowGraph) minCostFlow(ctx context.Context, s, t int) (flow int64, err error) {
+	n := len(g)
+	inf := math.Inf(1)
+
+	pot := make([]float64, n)
+	for i := range pot {
+		pot[i] = inf
+	}
+	pot[s] = 0
+	for round := 0; round < n; round++ {
+		updated := false
+		for u := 0; u < n; u++ {
+			if pot[u] == inf {
+				continue
+			}
+			for _, e := range g[u] {
+				if e.cap > 0 && pot[u]+e.cost < pot[e.to]-flowEpsilon {
+					pot[e.to] = pot[u] + e.cost
+					updated = true
+				}
+			}
+		}
+		if !updated {
+			break
+		}
+	}
+	for i := range pot {
+		if pot[i] == inf {
+			pot[i] = 0 // unreachable, stays unreachable.
+		}
+	}
+
+	dist := make([]float64, n)
+	prevNode := make([]int, n)
+	prevEdge := make([]int, n)
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		for i := range dist {
+			dist[i] = inf
+		}
+		dist[s] = 0
+
+		q := &flowQueue{{s, 0}}
+		for q.Len() > 0 {
+			item := heap.Pop(q).(flowItem)
+			u := item.node
+			if item.dist > dist[u] {
+				continue
+			}
+			for i, e := range g[u] {
+				if e.cap <= 0 {
+					continue
+				}
+				nd := dist[u] + e.cost + pot[u] - pot[e.to]
+				if nd < dist[e.to]-flowEpsilon {
+					dist[e.to] = nd
+					prevNode[e.to] = u
+					prevEdge[e.to] = i
+					heap.Push(q, flowItem{e.to, nd})
+				}
+			}
+		}
+
+		if dist[t] == inf {
+			return
+		}
+		for i := range pot {
+			if dist[i] != inf {
+				pot[i] += dist[i]
+			}
+		}
+
+		push := int64(math.MaxInt64)
+		for v := t; v != s; v = prevNode[v] {
+			push = minInt64(push, g[prevNode[v]][prevEdge[v]].cap)
+		}
+		for v := t; v != s; v = prevNode[v] {
+			e := &g[prevNode[v]][prevEdge[v]]
+			e.cap -= push
+			g[v][e.rev].cap += push
+		}
+		flow += push
+	}
+}
+
+type flowItem struct {
+	node int
+	dist float64
+}
+
+type flowQueue []flowItem
+
+func (q flowQueue) Len() int            { return len(q) }
+func (q flowQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q flowQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *flowQueue) Push(x interface{}) { *q = append(*q, x.(flowItem)) }
+func (q *flowQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
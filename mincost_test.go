@@ -0,0 +1,227 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"testing"
+)
+
+func sumAmount(records []BuyRecord) int64 {
+	total := int64(0)
+	for _, record := range records {
+		total += record.Amount
+	}
+	return total
+}
+
+// 1. 基础匹配测试
+func TestMinCostMatcher_Basic(t *testing.T) {
+	t.Run("OneSupplierTwoBuyers", func(t *testing.T) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 30, nil),
+			makeBuyer("b2", 40, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s1", "b2", 10.0)
+
+		matches, perfect := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+
+		if !perfect {
+			t.Error("Expected perfect match")
+		}
+		if sumAmount(matches["b1"]) != 30 || sumAmount(matches["b2"]) != 40 {
+			t.Errorf("Unexpected matches %v", matches)
+		}
+		if suppliers[0].CapRest != 30 {
+			t.Errorf("Expected supplier CapRest 30, got %d", suppliers[0].CapRest)
+		}
+		if buyers[0].DemandRest != 0 || buyers[1].DemandRest != 0 {
+			t.Error("Expected buyers DemandRest 0")
+		}
+	})
+
+	t.Run("PreferCheaper", func(t *testing.T) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+			makeSupplier("s2", 100, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 80, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 30.0)
+		affinity.setPrice("s2", "b1", 10.0)
+
+		matches, _ := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+
+		if len(matches["b1"]) != 1 || matches["b1"][0].SupplierID != "s2" {
+			t.Errorf("Expected to buy from s2 only, got %v", matches["b1"])
+		}
+	})
+}
+
+// 2. 贪心无法满足而最优可以满足的场景
+func TestMinCostMatcher_BetterThanGreedy(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+			makeSupplier("s2", 100, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 100, nil),
+			makeBuyer("b2", 100, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s1", "b2", 10.0)
+		affinity.setPrice("s2", "b1", 20.0)
+		affinity.setLimit("s2", "b2", 0) // s2 不能卖给 b2
+		return suppliers, buyers, affinity
+	}
+
+	suppliers, buyers, affinity := newCase()
+	_, perfect := GreedyMatcher(1.0, 0.0, 0, false, false).Match(suppliers, buyers, affinity)
+	if perfect {
+		t.Fatal("Expected greedy to leave demand unmet")
+	}
+
+	suppliers, buyers, affinity = newCase()
+	matches, perfect := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+	if !perfect {
+		t.Fatal("Expected perfect match")
+	}
+	if len(matches["b2"]) != 1 || matches["b2"][0].SupplierID != "s1" {
+		t.Errorf("Expected b2 to buy from s1, got %v", matches["b2"])
+	}
+	if len(matches["b1"]) != 1 || matches["b1"][0].SupplierID != "s2" {
+		t.Errorf("Expected b1 to buy from s2, got %v", matches["b1"])
+	}
+}
+
+// 3. 最小成本测试
+func TestMinCostMatcher_MinCost(t *testing.T) {
+	// s1 对两个买家都便宜，但对 b1 的优势更大
+	suppliers := []Supplier{
+		makeSupplier("s1", 50, 1, nil),
+		makeSupplier("s2", 50, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 50, nil),
+		makeBuyer("b2", 50, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 60.0)
+	affinity.setPrice("s1", "b2", 20.0)
+	affinity.setPrice("s2", "b2", 30.0)
+
+	matches, perfect := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+
+	if !perfect {
+		t.Fatal("Expected perfect match")
+	}
+	// 总成本: s1->b1 + s2->b2 = 50*10 + 50*30 = 2000 < 50*60 + 50*20 = 4000
+	if matches["b1"][0].SupplierID != "s1" || matches["b2"][0].SupplierID != "s2" {
+		t.Errorf("Unexpected matches %v", matches)
+	}
+}
+
+// 4. BuyLimit 与容量测试
+func TestMinCostMatcher_Limits(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 100, 1, nil),
+		makeSupplier("s2", 30, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 150, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 10.0)
+	affinity.setLimit("s1", "b1", 80)
+
+	matches, perfect := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+
+	if perfect {
+		t.Error("Expected non-perfect match")
+	}
+	if total := sumAmount(matches["b1"]); total != 110 {
+		t.Errorf("Expected total 110, got %d", total)
+	}
+	if buyers[0].DemandRest != 40 {
+		t.Errorf("Expected DemandRest 40, got %d", buyers[0].DemandRest)
+	}
+}
+
+// 5. 边界条件测试
+func TestMinCostMatcher_EdgeCases(t *testing.T) {
+	t.Run("EmptySuppliers", func(t *testing.T) {
+		buyers := []Buyer{
+			makeBuyer("b1", 100, nil),
+		}
+		matches, perfect := MinCostMatcher(false).Match(nil, buyers, newMockAffinityTable())
+		if perfect {
+			t.Error("Expected non-perfect match")
+		}
+		if len(matches) != 0 {
+			t.Errorf("Expected 0 matches, got %d", len(matches))
+		}
+	})
+
+	t.Run("ZeroDemandBuyer", func(t *testing.T) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 0, nil),
+			makeBuyer("b2", 50, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s1", "b2", 10.0)
+
+		matches, perfect := MinCostMatcher(false).Match(suppliers, buyers, affinity)
+		if !perfect {
+			t.Error("Expected perfect match")
+		}
+		if len(matches["b1"]) != 0 {
+			t.Errorf("Expected b1 to have no matches, got %d", len(matches["b1"]))
+		}
+		if sumAmount(matches["b2"]) != 50 {
+			t.Errorf("Expected b2 amount 50, got %d", sumAmount(matches["b2"]))
+		}
+	})
+}
+
+// 6. Context 取消测试
+func TestMinCostMatcher_Context(t *testing.T) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 100, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 50, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+
+	// 收集阶段检查 1 次，然后在第一次增广之前取消
+	ctx := &countdownContext{context.Background(), 1}
+	matches, perfect, err := MatchContext(ctx, MinCostMatcher(false), suppliers, buyers, affinity)
+
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if perfect || len(matches["b1"]) != 0 {
+		t.Errorf("Expected no matches, got %v", matches)
+	}
+	if suppliers[0].CapRest != 100 || buyers[0].DemandRest != 50 {
+		t.Error("Expected suppliers and buyers untouched")
+	}
+}
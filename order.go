@@ -0,0 +1,66 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import "sort"
+
+// The matchers never depend on the order of the input slices, buyers and suppliers
+// are ordered by their keys below, so a permutation of the inputs yields identical
+// Matches (given distinct IDs).
+
+// BuyerLess reports whether buyer a is served before buyer b: higher priority first,
+// then larger demand, then by ID. It is exported for the callers that order buyers the
+// same way, e.g. the output of package bandwidth.
+func BuyerLess(a, b *Buyer) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.Demand != b.Demand {
+		return a.Demand > b.Demand
+	}
+	return a.ID < b.ID
+}
+
+// supplierLess reports whether supplier a is preferred to supplier b: higher priority
+// first, then by ID.
+func supplierLess(a, b *Supplier) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.ID < b.ID
+}
+
+// buyerOrder returns the buyer indexes sorted by BuyerLess.
+func buyerOrder(buyers []Buyer) []int {
+	order := make([]int, len(buyers))
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(x, y int) bool {
+		return BuyerLess(&buyers[order[x]], &buyers[order[y]])
+	})
+	return order
+}
+
+// supplierOrder returns the supplier indexes sorted by supplierLess.
+func supplierOrder(suppliers []Supplier) []int {
+	order := make([]int, len(suppliers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(x, y int) bool {
+		return supplierLess(&suppliers[order[x]], &suppliers[order[y]])
+	})
+	return order
+}
+
+// ranks inverts an order, returns the position of every index in it.
+func ranks(order []int) []int {
+	rank := make([]int, len(order))
+	for r, i := range order {
+		rank[i] = r
+	}
+	return rank
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomCase 生成随机但可复现的测试数据，相同价格与相同需求大量出现
+func randomCase(r *rand.Rand) ([]Supplier, []Buyer, *mockAffinityTable) {
+	var suppliers []Supplier
+	for i := 0; i < 12; i++ {
+		suppliers = append(suppliers,
+			makeSupplier(fmt.Sprintf("s%02d", i), int64(10*(1+r.Intn(5))), int64(r.Intn(2)), nil))
+	}
+	var buyers []Buyer
+	for j := 0; j < 8; j++ {
+		buyers = append(buyers, makeBuyer(fmt.Sprintf("b%02d", j), int64(10*(1+r.Intn(4))), nil))
+	}
+	affinity := newMockAffinityTable()
+	for _, s := range suppliers {
+		for _, b := range buyers {
+			affinity.setPrice(s.ID, b.ID, float32(10*r.Intn(4)))
+			if r.Intn(4) == 0 {
+				affinity.setLimit(s.ID, b.ID, int64(r.Intn(20)))
+			}
+		}
+	}
+	return suppliers, buyers, affinity
+}
+
+// 1. 输入顺序的任意排列得到相同的 Matches
+func TestMatchers_PermutationInvariant(t *testing.T) {
+	matchers := map[string]func() Matcher{
+		"Greedy":          func() Matcher { return GreedyMatcher(10.0, 10.0, 2, false, false) },
+		"GreedyExclusive": func() Matcher { return GreedyMatcher(10.0, 10.0, 2, true, false) },
+		"MinCost":         func() Matcher { return MinCostMatcher(false) },
+		"Exclusive":       func() Matcher { return ExclusiveMatcher(false) },
+	}
+
+	for name, newMatcher := range matchers {
+		t.Run(name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				r := rand.New(rand.NewSource(seed))
+
+				suppliers, buyers, affinity := randomCase(r)
+				expected, expectedPerfect := newMatcher().Match(suppliers, buyers, affinity)
+
+				for n := 0; n < 3; n++ {
+					suppliers, buyers, _ := randomCase(rand.New(rand.NewSource(seed)))
+					r.Shuffle(len(suppliers), func(i, j int) { suppliers[i], suppliers[j] = suppliers[j], suppliers[i] })
+					r.Shuffle(len(buyers), func(i, j int) { buyers[i], buyers[j] = buyers[j], buyers[i] })
+
+					matches, perfect := newMatcher().Match(suppliers, buyers, affinity)
+					if perfect != expectedPerfect || !reflect.DeepEqual(matches, expected) {
+						t.Fatalf("seed %d: permutation changed the result\nexpected %v\ngot      %v", seed, expected, matches)
+					}
+				}
+			}
+		})
+	}
+}
+
+// 2. 买家与供应商的排序键
+func TestOrder(t *testing.T) {
+	buyers := []Buyer{
+		makeBuyer("b2", 10, nil),
+		makeBuyer("b1", 10, nil),
+		makeBuyer("b3", 20, nil),
+	}
+	if order := buyerOrder(buyers); !reflect.DeepEqual(order, []int{2, 1, 0}) {
+		t.Errorf("Unexpected buyer order %v", order)
+	}
+
+	suppliers := []Supplier{
+		makeSupplier("s2", 10, 1, nil),
+		makeSupplier("s3", 10, 2, nil),
+		makeSupplier("s1", 10, 1, nil),
+	}
+	order := supplierOrder(suppliers)
+	if !reflect.DeepEqual(order, []int{1, 2, 0}) {
+		t.Errorf("Unexpected supplier order %v", order)
+	}
+	if rank := ranks(order); !reflect.DeepEqual(rank, []int{2, 0, 1}) {
+		t.Errorf("Unexpected ranks %v", rank)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import "context"
+
+// Result is the result of Solve, the residual state is indexed like the inputs.
+type Result struct {
+	Matches Matches `json:"matches"`
+	Perfect bool    `json:"perfect"`
+
+	// The rest of the suppliers after matching.
+	CapRest      []int64   `json:"cap_rest"`
+	ExtraCapRest [][]int64 `json:"extra_cap_rest"`
+	BuyersRest   []int     `json:"buyers_rest"`
+
+	// The rest of the buyers after matching, a negative one means the buyer bought
+	// more than its demand.
+	DemandRest []int64 `json:"demand_rest"`
+}
+
+// Unmet returns the unmet demand of the j-th buyer.
+func (r *Result) Unmet(j int) int64 {
+	return maxInt64(r.DemandRest[j], 0)
+}
+
+// Solve runs m on copies of suppliers and buyers, leaving them untouched, and returns
+// the matches with the residual state. So several matchers can run side by side on the
+// same inputs.
+func Solve(m Matcher, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) Result {
+	r, _ := SolveContext(context.Background(), m, suppliers, buyers, affinities)
+	return r
+}
+
+// SolveContext is like Solve, see MatchContext for ctx.
+func SolveContext(ctx context.Context, m Matcher, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (r Result, err error) {
+	ss := copySuppliers(suppliers)
+	bs := append([]Buyer(nil), buyers...)
+
+	r.Matches, r.Perfect, err = MatchContext(ctx, m, ss, bs, affinities)
+
+	r.CapRest = make([]int64, len(ss))
+	r.ExtraCapRest = make([][]int64, len(ss))
+	r.BuyersRest = make([]int, len(ss))
+	for i := range ss {
+		r.CapRest[i] = ss[i].CapRest
+		r.ExtraCapRest[i] = ss[i].ExtraCapRest
+		r.BuyersRest[i] = ss[i].BuyersRest
+	}
+	r.DemandRest = make([]int64, len(bs))
+	for j := range bs {
+		r.DemandRest[j] = bs[j].DemandRest
+	}
+	return
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// 1. Solve 不修改输入，且与 Match 的结果一致
+func TestSolve(t *testing.T) {
+	suppliers := []Supplier{
+		makeExtraSupplier("s1", 100, 50),
+		makeExtraSupplier("s2", 50),
+	}
+	suppliers[0].MaxBuyers, suppliers[0].BuyersRest = 2, 2
+	buyers := []Buyer{
+		makeExtraBuyer("b1", 80, 40),
+		makeExtraBuyer("b2", 120, 40),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s1", "b2", 10.0)
+	affinity.setPrice("s2", "b1", 20.0)
+	affinity.setPrice("s2", "b2", 20.0)
+
+	copiedSuppliers := copySuppliers(suppliers)
+	copiedBuyers := append([]Buyer(nil), buyers...)
+
+	for name, m := range map[string]Matcher{
+		"Greedy":  GreedyMatcher(1.0, 0.0, 0, false, false),
+		"MinCost": MinCostMatcher(false),
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := Solve(m, suppliers, buyers, affinity)
+
+			if !reflect.DeepEqual(suppliers, copiedSuppliers) || !reflect.DeepEqual(buyers, copiedBuyers) {
+				t.Fatal("Expected inputs untouched")
+			}
+
+			ss, bs := copySuppliers(suppliers), append([]Buyer(nil), buyers...)
+			matches, perfect := m.Match(ss, bs, affinity)
+			if !reflect.DeepEqual(r.Matches, matches) || r.Perfect != perfect {
+				t.Errorf("Expected the same matches, got %v and %v", r.Matches, matches)
+			}
+			for i := range ss {
+				if r.CapRest[i] != ss[i].CapRest || r.BuyersRest[i] != ss[i].BuyersRest ||
+					!reflect.DeepEqual(r.ExtraCapRest[i], ss[i].ExtraCapRest) {
+					t.Errorf("Unexpected rest of %s", ss[i].ID)
+				}
+			}
+			for j := range bs {
+				if r.DemandRest[j] != bs[j].DemandRest {
+					t.Errorf("Expected DemandRest %d of %s, got %d", bs[j].DemandRest, bs[j].ID, r.DemandRest[j])
+				}
+				if r.Unmet(j) != maxInt64(bs[j].DemandRest, 0) {
+					t.Errorf("Unexpected unmet %d of %s", r.Unmet(j), bs[j].ID)
+				}
+			}
+		})
+	}
+}
+
+// 2. SolveContext 在 ctx 结束时返回错误
+func TestSolveContext_Canceled(t *testing.T) {
+	suppliers := []Supplier{makeSupplier("s1", 100, 1, nil)}
+	buyers := []Buyer{makeBuyer("b1", 50, nil)}
+	affinity := newMockAffinityTable()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r, err := SolveContext(ctx, GreedyMatcher(1.0, 0.0, 0, false, false), suppliers, buyers, affinity)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if r.DemandRest[0] != 50 || buyers[0].DemandRest != 50 {
+		t.Errorf("Expected nothing matched, got %v", r.DemandRest)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+// StickyAffinityTable wraps t to prefer the (supplier, buyer) pairs of a previous
+// result, their prices are reduced by stickiness (but not below zero). So a matcher
+// only moves a buyer to another supplier when it is cheaper by more than stickiness,
+// for GreedyMatcher the stickiness should be at least the sensitivity to take effect.
+//
+// The returned table is a CandidateTable when t is.
+func StickyAffinityTable(t AffinityTable, prev Matches, stickiness float32) AffinityTable {
+	kept := make(map[string]map[string]bool, len(prev)) // buyer => supplier
+	for buyerID, records := range prev {
+		suppliers := make(map[string]bool, len(records))
+		for _, record := range records {
+			suppliers[record.SupplierID] = true
+		}
+		kept[buyerID] = suppliers
+	}
+
+	return mapAffinities(t, func(supplier *Supplier, buyer *Buyer, a Affinity) Affinity {
+		if kept[buyer.ID][supplier.ID] {
+			a.Price -= stickiness
+			if a.Price < 0 {
+				a.Price = 0
+			}
+		}
+		return a
+	})
+}
+
+// Churn compares next with prev, returns the count and the total amount of the
+// records in next whose (supplier, buyer) pair is not in prev.
+func Churn(prev, next Matches) (moved int, amount int64) {
+	for buyerID, records := range next {
+		kept := make(map[string]bool, len(prev[buyerID]))
+		for _, record := range prev[buyerID] {
+			kept[record.SupplierID] = true
+		}
+		for _, record := range records {
+			if !kept[record.SupplierID] {
+				moved++
+				amount += record.Amount
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 1. 粘性价格测试
+func TestStickyAffinityTable(t *testing.T) {
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 30.0)
+	affinity.setPrice("s2", "b2", 5.0)
+
+	prev := Matches{"b1": {{"s2", 10}}, "b2": {{"s2", 10}}}
+	sticky := StickyAffinityTable(affinity, prev, 25.0)
+
+	s1, s2 := makeSupplier("s1", 100, 1, nil), makeSupplier("s2", 100, 1, nil)
+	b1, b2 := makeBuyer("b1", 10, nil), makeBuyer("b2", 10, nil)
+
+	if p := sticky.Find(&s1, &b1).Price; p != 10.0 {
+		t.Errorf("Expected unchanged price 10, got %f", p)
+	}
+	if p := sticky.Find(&s2, &b1).Price; p != 5.0 {
+		t.Errorf("Expected sticky price 5, got %f", p)
+	}
+	if p := sticky.Find(&s2, &b2).Price; p != 0.0 {
+		t.Errorf("Expected sticky price clamped to 0, got %f", p)
+	}
+
+	if _, ok := sticky.(CandidateTable); ok {
+		t.Error("Expected no CandidateTable for a plain AffinityTable")
+	}
+	ct := &mockCandidateTable{mockAffinityTable: affinity}
+	if _, ok := StickyAffinityTable(ct, prev, 25.0).(CandidateTable); !ok {
+		t.Error("Expected CandidateTable to be preserved")
+	}
+}
+
+// 2. 粘性匹配保留之前的分配
+func TestStickyAffinityTable_Match(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, *mockAffinityTable) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+			makeSupplier("s2", 100, 1, nil),
+		}
+		buyers := []Buyer{
+			makeBuyer("b1", 50, nil),
+		}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b1", 20.0)
+		return suppliers, buyers, affinity
+	}
+	prev := Matches{"b1": {{"s2", 50}}}
+
+	for name, m := range map[string]Matcher{
+		"Greedy":  GreedyMatcher(1.0, 0.0, 0, false, false),
+		"MinCost": MinCostMatcher(false),
+	} {
+		t.Run(name, func(t *testing.T) {
+			suppliers, buyers, affinity := newCase()
+			next, _ := m.Match(suppliers, buyers, affinity)
+			if moved, amount := Churn(prev, next); moved != 1 || amount != 50 {
+				t.Errorf("Expected 1 moved record without stickiness, got %d %d", moved, amount)
+			}
+
+			suppliers, buyers, affinity = newCase()
+			next, _ = m.Match(suppliers, buyers, StickyAffinityTable(affinity, prev, 15.0))
+			if !reflect.DeepEqual(next["b1"], prev["b1"]) {
+				t.Errorf("Expected b1 to stay on s2, got %v", next["b1"])
+			}
+			if moved, amount := Churn(prev, next); moved != 0 || amount != 0 {
+				t.Errorf("Expected no churn, got %d %d", moved, amount)
+			}
+		})
+	}
+}
+
+// 3. Churn 统计
+func TestChurn(t *testing.T) {
+	prev := Matches{
+		"b1": {{"s1", 10}, {"s2", 20}},
+		"b2": {{"s3", 30}},
+	}
+	next := Matches{
+		"b1": {{"s1", 15}, {"s3", 15}}, // s3 新增
+		"b2": {{"s3", 30}},
+		"b3": {{"s1", 5}}, // 新买家
+	}
+	moved, amount := Churn(prev, next)
+	if moved != 2 || amount != 20 {
+		t.Errorf("Expected 2 moved records of 20, got %d %d", moved, amount)
+	}
+	if moved, _ := Churn(next, next); moved != 0 {
+		t.Errorf("Expected no churn against itself, got %d", moved)
+	}
+}
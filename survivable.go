@@ -0,0 +1,222 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+)
+
+// SurvivableOption configures SurvivableMatcher and CheckSurvivable.
+type SurvivableOption struct {
+	// The ratio of Buyer.Demand a buyer must keep after the loss, (0.0-1.0], 1.0 when
+	// out of range.
+	Fraction float32 `json:"fraction"`
+
+	// Survive the loss of any one Supplier.Domain instead of any one supplier, a
+	// supplier without domain is a domain of its own.
+	Domain bool `json:"domain"`
+}
+
+// The max top-up runs of SurvivableMatcher.
+const survivableRounds = 8
+
+type survivableMatcher struct {
+	m Matcher
+	o SurvivableOption
+}
+
+// SurvivableMatcher wraps m to over-provision the buyers, so that every buyer still
+// keeps Fraction of its demand after losing any one supplier (or domain, see
+// SurvivableOption.Domain).
+//
+// After m is run, the buyers that can not survive the loss of their largest supplier
+// are topped up by running m again for the shortfall, in which a buyer can buy from a
+// supplier (or domain) no more than its largest one has, so the largest one does not
+// grow. It is repeated until all the buyers are survivable or nothing more is bought.
+// The amounts topped up reduce DemandRest below zero.
+//
+// Use CheckSurvivable to find out the buyers that are still not survivable.
+func SurvivableMatcher(m Matcher, o SurvivableOption) Matcher {
+	return survivableMatcher{m, o}
+}
+
+func (m survivableMatcher) Match(suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool) {
+	matches, perfect, _ = m.MatchContext(context.Background(), suppliers, buyers, affinities)
+	return
+}
+
+func (m survivableMatcher) MatchContext(ctx context.Context, suppliers []Supplier, buyers []Buyer, affinities AffinityTable) (matches Matches, perfect bool, err error) {
+	matches, _, err = MatchContext(ctx, m.m, suppliers, buyers, affinities)
+	if err != nil {
+		return
+	}
+
+	units := supplierUnits(suppliers, m.o.Domain)
+
+	// The amounts of the units of the buyers, and the largest one, by the matches
+	// before the current run.
+	var (
+		bought  map[string]map[string]int64
+		largest map[string]int64
+	)
+
+	// A buyer can not buy from a unit more than its largest one.
+	rested := mapAffinities(affinities, func(supplier *Supplier, buyer *Buyer, a Affinity) Affinity {
+		amount := int64(0)
+		records := matches[buyer.ID]
+		if k := recordIndex(records, supplier.ID); k >= 0 {
+			amount = records[k].Amount
+		}
+		headroom := maxInt64(largest[buyer.ID]-bought[buyer.ID][units[supplier.ID]], 0)
+		a.Limit = restLimit{a.Limit, minInt64(maxShare(buyer), amount+headroom), amount}
+		return a
+	})
+
+	for round := 0; round < survivableRounds; round++ {
+		bought = make(map[string]map[string]int64)
+		largest = make(map[string]int64)
+
+		var (
+			sub        []Buyer
+			index      []int
+			shortfalls []int64
+		)
+		for j := range buyers {
+			buyer := &buyers[j]
+			amounts := unitAmounts(matches[buyer.ID], units)
+			kept, _ := survived(amounts)
+			if shortfall := m.o.target(buyer) - kept; shortfall > 0 {
+				bought[buyer.ID] = amounts
+				for _, amount := range amounts {
+					largest[buyer.ID] = maxInt64(largest[buyer.ID], amount)
+				}
+				b := *buyer
+				b.DemandRest = shortfall
+				sub = append(sub, b)
+				index = append(index, j)
+				shortfalls = append(shortfalls, shortfall)
+			}
+		}
+		if len(sub) == 0 {
+			break
+		}
+
+		// In the domain mode, the headroom is also capped by domain, as a buyer may buy
+		// from several suppliers of a domain.
+		runCtx := withPrior(ctx, matches)
+		if m.o.Domain {
+			runCtx = withDomainCaps(runCtx, largest)
+		}
+
+		var ms Matches
+		ms, _, err = MatchContext(runCtx, m.m, suppliers, sub, rested)
+		restoreBuyers(suppliers, matches, ms)
+		mergeMatches(matches, ms)
+
+		topped := false
+		for k, j := range index {
+			if got := shortfalls[k] - sub[k].DemandRest; got > 0 {
+				buyers[j].DemandRest -= got
+				topped = true
+			}
+		}
+		if err != nil || !topped {
+			break
+		}
+	}
+
+	perfect = true
+	for j := 0; j < len(buyers); j++ {
+		if buyers[j].DemandRest > 0 {
+			perfect = false
+			break
+		}
+	}
+	return
+}
+
+// target returns the amount the buyer must keep after the loss.
+func (o SurvivableOption) target(buyer *Buyer) int64 {
+	f := o.Fraction
+	if !(f > 0 && f <= 1) {
+		f = 1
+	}
+	// Tolerates the float32 precision, e.g. 0.7 is 0.69999999.
+	return int64(math.Ceil(float64(f) * float64(buyer.Demand) * (1 - 1e-6)))
+}
+
+// supplierUnits returns the units (supplier ID or domain) of the suppliers by ID.
+func supplierUnits(suppliers []Supplier, domain bool) map[string]string {
+	units := make(map[string]string, len(suppliers))
+	for i := range suppliers {
+		units[suppliers[i].ID] = suppliers[i].ID
+		if domain && suppliers[i].Domain != "" {
+			units[suppliers[i].ID] = "domain:" + suppliers[i].Domain
+		}
+	}
+	return units
+}
+
+// unitAmounts sums the amounts of the records by unit.
+func unitAmounts(records []BuyRecord, units map[string]string) map[string]int64 {
+	amounts := make(map[string]int64, len(records))
+	for _, record := range records {
+		unit, ok := units[record.SupplierID]
+		if !ok {
+			unit = record.SupplierID
+		}
+		amounts[unit] += record.Amount
+	}
+	return amounts
+}
+
+// survived returns the amount kept after losing the largest unit, and the unit.
+func survived(amounts map[string]int64) (kept int64, lost string) {
+	largest := int64(0)
+	for unit, amount := range amounts {
+		kept += amount
+		if amount > largest || amount == largest && unit < lost {
+			largest, lost = amount, unit
+		}
+	}
+	return kept - largest, lost
+}
+
+// Unsurvivable describes a buyer that can not keep the target amount after a loss.
+type Unsurvivable struct {
+	BuyerID string `json:"buyer"`
+	Target  int64  `json:"target"` // the amount to keep
+	Kept    int64  `json:"kept"`   // the amount kept after the loss
+	Lost    string `json:"lost"`   // the supplier ID, or the domain, lost
+}
+
+// CheckSurvivable returns the buyers (by ID) whose matches can not keep the target
+// amount after losing any one supplier or domain by the option, or nil.
+func CheckSurvivable(suppliers []Supplier, buyers []Buyer, matches Matches, o SurvivableOption) []Unsurvivable {
+	units := supplierUnits(suppliers, o.Domain)
+
+	var us []Unsurvivable
+	for j := range buyers {
+		buyer := &buyers[j]
+		target := o.target(buyer)
+		if target <= 0 {
+			continue
+		}
+		kept, lost := survived(unitAmounts(matches[buyer.ID], units))
+		if kept < target {
+			if o.Domain {
+				lost = strings.TrimPrefix(lost, "domain:")
+			}
+			us = append(us, Unsurvivable{buyer.ID, target, kept, lost})
+		}
+	}
+	sort.Slice(us, func(i, j int) bool {
+		return us[i].BuyerID < us[j].BuyerID
+	})
+	return us
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 1. 失去任意一个供应商后仍能满足需求
+func TestSurvivableMatcher(t *testing.T) {
+	newCase := func() ([]Supplier, []Buyer, AffinityTable) {
+		suppliers := []Supplier{
+			makeSupplier("s1", 100, 1, nil),
+			makeSupplier("s2", 100, 1, nil),
+			makeSupplier("s3", 100, 1, nil),
+		}
+		buyers := []Buyer{makeBuyer("b1", 60, nil)}
+		affinity := newMockAffinityTable()
+		affinity.setPrice("s1", "b1", 10.0)
+		affinity.setPrice("s2", "b1", 20.0)
+		affinity.setPrice("s3", "b1", 30.0)
+		return suppliers, buyers, affinity
+	}
+
+	for name, m := range map[string]Matcher{
+		"Greedy":  GreedyMatcher(1.0, 0.0, 0, false, false),
+		"MinCost": MinCostMatcher(false),
+	} {
+		t.Run(name, func(t *testing.T) {
+			suppliers, buyers, affinity := newCase()
+			original := append([]Supplier(nil), suppliers...)
+			o := SurvivableOption{Fraction: 1.0}
+
+			// 不加保护时只从最便宜的 s1 购买
+			plain, _ := m.Match(append([]Supplier(nil), original...), append([]Buyer(nil), buyers...), affinity)
+			if us := CheckSurvivable(original, buyers, plain, o); len(us) != 1 {
+				t.Errorf("Expected b1 unsurvivable without protection, got %v", us)
+			}
+
+			matches, perfect := SurvivableMatcher(m, o).Match(suppliers, buyers, affinity)
+			if !perfect {
+				t.Fatalf("Expected perfect match, got %v", matches)
+			}
+			if us := CheckSurvivable(original, buyers, matches, o); us != nil {
+				t.Errorf("Expected survivable, got %v: %v", us, matches)
+			}
+			if vs := Verify(original, buyers, affinity, matches, false); vs != nil {
+				t.Errorf("Unexpected violations: %v", vs)
+			}
+			if total := sumRecords(matches["b1"]); buyers[0].DemandRest != 60-total {
+				t.Errorf("Expected DemandRest %d, got %d", 60-total, buyers[0].DemandRest)
+			}
+		})
+	}
+}
+
+// 2. 失去任意一个故障域后仍能满足一半需求
+func TestSurvivableMatcher_Domain(t *testing.T) {
+	suppliers := []Supplier{
+		makeDomainSupplier("s1", 100, "idc1"),
+		makeDomainSupplier("s2", 100, "idc1"),
+		makeDomainSupplier("s3", 100, "idc2"),
+	}
+	buyers := []Buyer{makeBuyer("b1", 100, nil)}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 10.0)
+	affinity.setPrice("s3", "b1", 30.0)
+
+	original := append([]Supplier(nil), suppliers...)
+	o := SurvivableOption{Fraction: 0.5, Domain: true}
+	matches, _ := SurvivableMatcher(GreedyMatcher(1.0, 0.0, 0, false, false), o).Match(suppliers, buyers, affinity)
+
+	if us := CheckSurvivable(original, buyers, matches, o); us != nil {
+		t.Errorf("Expected survivable, got %v: %v", us, matches)
+	}
+	if amount := domainAmount(original, matches["b1"], "idc2"); amount < 50 {
+		t.Errorf("Expected at least 50 from idc2, got %d", amount)
+	}
+}
+
+// 3. 报告无法满足的买家
+func TestCheckSurvivable(t *testing.T) {
+	suppliers := []Supplier{
+		makeDomainSupplier("s1", 100, "idc1"),
+		makeDomainSupplier("s2", 100, "idc1"),
+	}
+	buyers := []Buyer{makeBuyer("b1", 60, nil), makeBuyer("b2", 60, nil)}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b2", 10.0)
+
+	o := SurvivableOption{Domain: true}
+	matches, _ := SurvivableMatcher(MinCostMatcher(false), o).Match(suppliers, buyers, affinity)
+
+	want := []Unsurvivable{
+		{BuyerID: "b1", Target: 60, Kept: 0, Lost: "idc1"},
+		{BuyerID: "b2", Target: 60, Kept: 0, Lost: "idc1"},
+	}
+	if us := CheckSurvivable(suppliers, buyers, matches, o); !reflect.DeepEqual(us, want) {
+		t.Errorf("Expected %v, got %v", want, us)
+	}
+}
+
+// 4. 故障域模式下，补足时同一故障域的多个供应商合计不超过最大的故障域
+func TestSurvivableMatcher_DomainTopUp(t *testing.T) {
+	suppliers := []Supplier{
+		makeDomainSupplier("a1", 6, "idc1"),
+		makeDomainSupplier("b1", 5, "idc2"),
+		makeDomainSupplier("b2", 5, "idc2"),
+		makeDomainSupplier("c1", 10, "idc3"),
+	}
+	buyers := []Buyer{makeBuyer("x", 10, nil)}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("a1", "x", 10.0)
+	affinity.setPrice("b1", "x", 20.0)
+	affinity.setPrice("b2", "x", 20.0)
+	affinity.setPrice("c1", "x", 30.0)
+
+	original := append([]Supplier(nil), suppliers...)
+	o := SurvivableOption{Fraction: 1.0, Domain: true}
+	matches, _ := SurvivableMatcher(GreedyMatcher(1.0, 0.0, 0, false, false), o).Match(suppliers, buyers, affinity)
+
+	if us := CheckSurvivable(original, buyers, matches, o); us != nil {
+		t.Errorf("Expected survivable, got %v: %v", us, matches)
+	}
+	if amount := domainAmount(original, matches["x"], "idc2"); amount > 6 {
+		t.Errorf("Expected at most 6 from idc2, got %d: %v", amount, matches)
+	}
+	if amount := domainAmount(original, matches["x"], "idc3"); amount < 4 {
+		t.Errorf("Expected at least 4 from idc3, got %d: %v", amount, matches)
+	}
+}
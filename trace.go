@@ -0,0 +1,249 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Tracer receives the events emitted during matching.
+//
+// A tracer is carried by the context passed to MatchContext, see WithTracer. When the
+// context carries no tracer, a matcher created with verbose traces as text to stdout.
+type Tracer interface {
+	Trace(e Event)
+}
+
+// Event is a typed matching event, e.g. TierStarted, Allocated or BuyerStopped.
+// Other packages may define their own events.
+type Event interface {
+	// Kind returns the short name of the event type.
+	Kind() string
+}
+
+// DetailTracer is a Tracer that receives the detail events too, e.g. Considered, which
+// are emitted for every pair considered and are not sent to the other tracers. Recorder
+// is a DetailTracer, see Detailed for the others.
+type DetailTracer interface {
+	Tracer
+	TracesDetail()
+}
+
+type detailTracer struct {
+	Tracer
+}
+
+func (detailTracer) TracesDetail() {}
+
+// Detailed returns a DetailTracer that sends all the events to t.
+func Detailed(t Tracer) DetailTracer {
+	if d, ok := t.(DetailTracer); ok {
+		return d
+	}
+	return detailTracer{t}
+}
+
+// tracesDetail tells whether t receives the detail events.
+func tracesDetail(t Tracer) bool {
+	_, ok := t.(DetailTracer)
+	return ok
+}
+
+type TracerFunc func(e Event)
+
+func (f TracerFunc) Trace(e Event) {
+	f(e)
+}
+
+type tracerKey struct{}
+
+// WithTracer returns a copy of ctx that carries the tracer.
+func WithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// ContextTracer returns the tracer carried by ctx, or nil.
+func ContextTracer(ctx context.Context) Tracer {
+	t, _ := ctx.Value(tracerKey{}).(Tracer)
+	return t
+}
+
+// contextTracer returns the tracer carried by ctx, or a stdout text tracer when verbose,
+// or nil.
+func contextTracer(ctx context.Context, verbose bool) Tracer {
+	if t := ContextTracer(ctx); t != nil {
+		return t
+	}
+	if verbose {
+		return NewTextTracer(os.Stdout)
+	}
+	return nil
+}
+
+// TierStarted is emitted by GreedyMatcher when it starts to allocate a price tier
+// of a buyer.
+type TierStarted struct {
+	BuyerID    string  `json:"buyer"`
+	Tier       int     `json:"tier"`
+	Price      float32 `json:"price"` // the lowest price in the tier
+	Demand     int64   `json:"demand"`
+	DemandRest int64   `json:"demand_rest"`
+	Available  int64   `json:"available"`
+	FactorSum  int64   `json:"factor_sum"`
+}
+
+func (e TierStarted) Kind() string {
+	return "tier_started"
+}
+
+func (e TierStarted) String() string {
+	return fmt.Sprint(e.BuyerID, " demand: ", e.Demand, " demand_rest: ", e.DemandRest,
+		" available: ", e.Available, " factor_sum: ", e.FactorSum)
+}
+
+// Allocated is emitted when an amount of a supplier is allocated to a buyer.
+type Allocated struct {
+	BuyerID    string  `json:"buyer"`
+	SupplierID string  `json:"supplier"`
+	Price      float32 `json:"price"`
+	Amount     int64   `json:"amount"`
+}
+
+func (e Allocated) Kind() string {
+	return "allocated"
+}
+
+func (e Allocated) String() string {
+	return fmt.Sprint("   ", e.BuyerID, " ", e.Price, " ", e.SupplierID, " ", e.Amount)
+}
+
+// Considered is emitted by GreedyMatcher for every (supplier, buyer) pair it considers
+// in a price tier. Amount is the amount to buy, Skipped is the reason when not bought.
+// It is a detail event, see DetailTracer.
+type Considered struct {
+	BuyerID    string  `json:"buyer"`
+	SupplierID string  `json:"supplier"`
+	Price      float32 `json:"price"`
+	Tier       int     `json:"tier"`
+	Limit      int64   `json:"limit"` // the calculated BuyLimit
+	CapRest    int64   `json:"cap_rest"`
+	DemandRest int64   `json:"demand_rest"`
+	Amount     int64   `json:"amount"`
+	Skipped    string  `json:"skipped,omitempty"`
+}
+
+// The reasons of Considered.Skipped.
+const (
+	// The BuyLimit, capacity or the share of the tier is exhausted.
+	SkipZeroAmount = "zero_amount"
+	// In exclusive mode, the supplier can not be bought whole.
+	SkipNotWhole = "not_whole"
+	// The supplier can not afford GreedyOption.MinAmount.
+	SkipBelowMinimum = "below_minimum"
+	// The supplier serves Supplier.MaxBuyers buyers already.
+	SkipMaxBuyers = "max_buyers"
+	// The buyer bought its max amount from the domain of the supplier.
+	SkipDomain = "domain"
+)
+
+func (e Considered) Kind() string {
+	return "considered"
+}
+
+func (e Considered) String() string {
+	s := fmt.Sprint("   ", e.BuyerID, " ", e.SupplierID, " price: ", e.Price, " tier: ", e.Tier,
+		" limit: ", e.Limit, " cap_rest: ", e.CapRest, " demand_rest: ", e.DemandRest, " amount: ", e.Amount)
+	if e.Skipped != "" {
+		s += " skipped: " + e.Skipped
+	}
+	return s
+}
+
+// BuyerStopped is emitted when a matcher stops matching a buyer.
+type BuyerStopped struct {
+	BuyerID string  `json:"buyer"`
+	Price   float32 `json:"price"` // the price of the last allocation, zero when none or for StopPerfect and StopExhausted.
+	Reason  string  `json:"reason"`
+}
+
+// The reasons of BuyerStopped.
+const (
+	// The demand is satisfied with enough suppliers, and the price is above the
+	// bottom (or in exclusive mode), so the higher tiers are not considered.
+	StopSatisfied = "satisfied"
+	// All the buyers are satisfied, the matching ended.
+	StopPerfect = "perfect"
+	// All the suppliers of the buyer are considered.
+	StopExhausted = "exhausted"
+)
+
+func (e BuyerStopped) Kind() string {
+	return "buyer_stopped"
+}
+
+func (e BuyerStopped) String() string {
+	return fmt.Sprint(e.BuyerID, " stopped: ", e.Reason, " price: ", e.Price)
+}
+
+type textTracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTextTracer creates a tracer that writes one line per event, using the event's
+// String method when it has one.
+func NewTextTracer(w io.Writer) Tracer {
+	return &textTracer{w: w}
+}
+
+func (t *textTracer) Trace(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := e.(fmt.Stringer); ok {
+		fmt.Fprintln(t.w, s.String())
+		return
+	}
+	fmt.Fprintf(t.w, "%s %+v\n", e.Kind(), e)
+}
+
+type jsonTracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONTracer creates a tracer that writes one JSON object per line:
+//
+//	{"kind":"allocated","event":{"buyer":"...","supplier":"...","price":10,"amount":5}}
+func NewJSONTracer(w io.Writer) Tracer {
+	return &jsonTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *jsonTracer) Trace(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.enc.Encode(struct {
+		Kind  string `json:"kind"`
+		Event Event  `json:"event"`
+	}{e.Kind(), e})
+}
+
+// Recorder is a tracer that records all the events in memory.
+type Recorder struct {
+	mu     sync.Mutex
+	Events []Event
+}
+
+func (r *Recorder) Trace(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Events = append(r.Events, e)
+}
+
+func (r *Recorder) TracesDetail() {}
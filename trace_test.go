@@ -0,0 +1,170 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func tracedCase() ([]Supplier, []Buyer, AffinityTable) {
+	suppliers := []Supplier{
+		makeSupplier("s1", 100, 1, nil),
+		makeSupplier("s2", 100, 1, nil),
+	}
+	buyers := []Buyer{
+		makeBuyer("b1", 50, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setPrice("s1", "b1", 10.0)
+	affinity.setPrice("s2", "b1", 50.0)
+	return suppliers, buyers, affinity
+}
+
+// 1. Recorder 记录贪心匹配事件
+func TestTracer_Recorder(t *testing.T) {
+	suppliers, buyers, affinity := tracedCase()
+
+	rec := &Recorder{}
+	ctx := WithTracer(context.Background(), rec)
+	_, perfect, err := MatchContext(ctx, GreedyMatcher(1.0, 0.0, 0, false, false), suppliers, buyers, affinity)
+	if err != nil || !perfect {
+		t.Fatalf("Expected perfect match, got %v %v", perfect, err)
+	}
+
+	var kinds []string
+	for _, e := range rec.Events {
+		kinds = append(kinds, e.Kind())
+	}
+	expected := []string{"tier_started", "considered", "allocated", "buyer_stopped"}
+	if strings.Join(kinds, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected events %v, got %v", expected, kinds)
+	}
+
+	tier := rec.Events[0].(TierStarted)
+	if tier.BuyerID != "b1" || tier.Demand != 50 || tier.DemandRest != 50 || tier.Available != 100 {
+		t.Errorf("Unexpected %+v", tier)
+	}
+	if e := rec.Events[1].(Considered); e.SupplierID != "s1" || e.Amount != 50 || e.Skipped != "" {
+		t.Errorf("Unexpected %+v", e)
+	}
+	if e := rec.Events[2].(Allocated); e != (Allocated{"b1", "s1", 10.0, 50}) {
+		t.Errorf("Unexpected %+v", e)
+	}
+	if e := rec.Events[3].(BuyerStopped); e.Reason != StopSatisfied || e.Price != 10.0 {
+		t.Errorf("Unexpected %+v", e)
+	}
+}
+
+// 2. 其他匹配器的分配事件
+func TestTracer_Allocated(t *testing.T) {
+	matchers := map[string]Matcher{
+		"MinCost":   MinCostMatcher(false),
+		"Exclusive": ExclusiveMatcher(false),
+	}
+	for name, m := range matchers {
+		t.Run(name, func(t *testing.T) {
+			suppliers, buyers, affinity := tracedCase()
+
+			rec := &Recorder{}
+			MatchContext(WithTracer(context.Background(), rec), m, suppliers, buyers, affinity)
+
+			if len(rec.Events) != 1 {
+				t.Fatalf("Expected 1 event, got %v", rec.Events)
+			}
+			e, ok := rec.Events[0].(Allocated)
+			if !ok || e.BuyerID != "b1" || e.SupplierID != "s1" || e.Price != 10.0 {
+				t.Errorf("Unexpected %+v", rec.Events[0])
+			}
+		})
+	}
+}
+
+// 3. 文本与 JSON 输出
+func TestTracer_Output(t *testing.T) {
+	e := Allocated{"b1", "s1", 10.0, 50}
+
+	t.Run("Text", func(t *testing.T) {
+		var buf bytes.Buffer
+		NewTextTracer(&buf).Trace(e)
+		if buf.String() != e.String()+"\n" {
+			t.Errorf("Unexpected %q", buf.String())
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		tracer := NewJSONTracer(&buf)
+		tracer.Trace(e)
+		tracer.Trace(BuyerStopped{"b1", 50.0, StopSatisfied})
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 lines, got %q", buf.String())
+		}
+		var decoded struct {
+			Kind  string    `json:"kind"`
+			Event Allocated `json:"event"`
+		}
+		if err := json.Unmarshal([]byte(lines[0]), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Kind != "allocated" || decoded.Event != e {
+			t.Errorf("Unexpected %+v", decoded)
+		}
+	})
+
+	t.Run("Silent", func(t *testing.T) {
+		if contextTracer(context.Background(), false) != nil {
+			t.Error("Expected no tracer")
+		}
+		rec := &Recorder{}
+		if contextTracer(WithTracer(context.Background(), rec), true) != rec {
+			t.Error("Expected the context tracer to take precedence")
+		}
+	})
+}
+
+// 4. 细节事件只发送给 DetailTracer
+func TestTracer_Detail(t *testing.T) {
+	var kinds []string
+	tracer := TracerFunc(func(e Event) { kinds = append(kinds, e.Kind()) })
+
+	suppliers, buyers, affinity := tracedCase()
+	MatchContext(WithTracer(context.Background(), tracer), GreedyMatcher(1.0, 0.0, 0, false, false),
+		suppliers, buyers, affinity)
+	if expected := "tier_started,allocated,buyer_stopped"; strings.Join(kinds, ",") != expected {
+		t.Errorf("Expected events %v, got %v", expected, kinds)
+	}
+
+	kinds = nil
+	suppliers, buyers, affinity = tracedCase()
+	MatchContext(WithTracer(context.Background(), Detailed(tracer)), GreedyMatcher(1.0, 0.0, 0, false, false),
+		suppliers, buyers, affinity)
+	if expected := "tier_started,considered,allocated,buyer_stopped"; strings.Join(kinds, ",") != expected {
+		t.Errorf("Expected events %v, got %v", expected, kinds)
+	}
+}
+
+// 5. 在后续价格层开始时已满足的买家，停止价格为最后一次分配的价格
+func TestTracer_StoppedPrice(t *testing.T) {
+	suppliers, buyers, affinity := tracedCase()
+	// b2 无法满足，匹配不会提前结束
+	buyers = append(buyers, makeBuyer("b2", 500, nil))
+	affinity.(*mockAffinityTable).setLimit("s1", "b2", 0)
+	affinity.(*mockAffinityTable).setPrice("s2", "b2", 60.0)
+
+	rec := &Recorder{}
+	ctx := WithTracer(context.Background(), rec)
+	MatchContext(ctx, GreedyMatcher(1.0, 100.0, 0, false, false), suppliers, buyers, affinity)
+
+	x := Explain(rec.Events, "b1", "s1")
+	if x.Stopped == nil || x.Stopped.Reason != StopSatisfied || x.Stopped.Price != 10.0 {
+		t.Errorf("Expected b1 stopped satisfied at price 10, got %v", x)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 someonegg. All rights reserscoreed.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The kinds of Violation.
+const (
+	ViolationUnknownBuyer    = "unknown_buyer"    // the buyer of the records is unknown
+	ViolationUnknownSupplier = "unknown_supplier" // the supplier of a record is unknown
+	ViolationNonPositive     = "non_positive"     // the amount of a record is not positive
+	ViolationDuplicate       = "duplicate"        // a supplier is recorded twice for a buyer
+	ViolationOverLimit       = "over_limit"       // the amount of a record exceeds the BuyLimit or MaxShare
+	ViolationOverAllocated   = "over_allocated"   // the total amount of a supplier exceeds its Cap
+	ViolationOverExtraCap    = "over_extra_cap"   // the extra capacity of a supplier is exceeded
+	ViolationShared          = "shared"           // a supplier is sold to more buyers in exclusive mode
+	ViolationOverBuyers      = "over_buyers"      // a supplier is sold to more buyers than its MaxBuyers
+	ViolationOverDomain      = "over_domain"      // a buyer buys more from a domain than its domain limit
+)
+
+// Violation describes a broken invariant of Matches.
+type Violation struct {
+	Kind       string `json:"kind"`
+	BuyerID    string `json:"buyer,omitempty"`
+	SupplierID string `json:"supplier,omitempty"`
+	Domain     string `json:"domain,omitempty"`
+	Amount     int64  `json:"amount"` // the amount that violates
+	Limit      int64  `json:"limit"`  // the limit that is violated, if any
+}
+
+func (v Violation) String() string {
+	s := fmt.Sprintf("%s buyer: %q supplier: %q amount: %d limit: %d",
+		v.Kind, v.BuyerID, v.SupplierID, v.Amount, v.Limit)
+	if v.Domain != "" {
+		s += fmt.Sprintf(" domain: %q", v.Domain)
+	}
+	return s
+}
+
+type Violations []Violation
+
+func (vs Violations) Error() string {
+	ss := make([]string, len(vs))
+	for i, v := range vs {
+		ss[i] = v.String()
+	}
+	return fmt.Sprintf("%d violations: %s", len(vs), strings.Join(ss, "; "))
+}
+
+// Verify checks matches against the original suppliers and buyers (their Cap, Demand,
+// ExtraCap, MaxBuyers and the shares, the rests are not used), and returns every violation in
+// a stable order, or nil.
+//
+// The amount a buyer buys may exceed its demand, e.g. GreedyMatcher does it to get
+// enough suppliers, so it is not a violation.
+func Verify(suppliers []Supplier, buyers []Buyer, affinities AffinityTable, matches Matches, exclusive bool) Violations {
+	var vs Violations
+
+	supplierIndex := make(map[string]int, len(suppliers))
+	for i := range suppliers {
+		supplierIndex[suppliers[i].ID] = i
+	}
+	buyerIndex := make(map[string]int, len(buyers))
+	for j := range buyers {
+		buyerIndex[buyers[j].ID] = j
+	}
+
+	buyerIDs := make([]string, 0, len(matches))
+	for buyerID := range matches {
+		buyerIDs = append(buyerIDs, buyerID)
+	}
+	sort.Strings(buyerIDs)
+
+	sold := make([]int64, len(suppliers))
+	extraSold := make([][]int64, len(suppliers))
+	soldTo := make([][]string, len(suppliers))
+
+	for _, buyerID := range buyerIDs {
+		records := matches[buyerID]
+		j, ok := buyerIndex[buyerID]
+		if !ok {
+			if len(records) > 0 {
+				vs = append(vs, Violation{Kind: ViolationUnknownBuyer, BuyerID: buyerID, Amount: sumRecords(records)})
+			}
+			continue
+		}
+		buyer := &buyers[j]
+
+		recorded := make(map[string]bool, len(records))
+		var domains []string // in the order of the records
+		domainSold := make(map[string]int64)
+		for _, record := range records {
+			v := Violation{BuyerID: buyerID, SupplierID: record.SupplierID, Amount: record.Amount}
+
+			i, ok := supplierIndex[record.SupplierID]
+			if !ok {
+				v.Kind = ViolationUnknownSupplier
+				vs = append(vs, v)
+				continue
+			}
+			supplier := &suppliers[i]
+
+			if record.Amount <= 0 {
+				v.Kind = ViolationNonPositive
+				vs = append(vs, v)
+				continue
+			}
+			if recorded[record.SupplierID] {
+				v.Kind = ViolationDuplicate
+				vs = append(vs, v)
+			}
+			recorded[record.SupplierID] = true
+
+			limit := MaxBuy(affinities.Find(supplier, buyer), supplier, buyer)
+			if record.Amount > limit {
+				v.Kind, v.Limit = ViolationOverLimit, limit
+				vs = append(vs, v)
+			}
+
+			sold[i] += record.Amount
+			if domain := supplier.Domain; domain != "" {
+				if _, ok := domainSold[domain]; !ok {
+					domains = append(domains, domain)
+				}
+				domainSold[domain] += record.Amount
+			}
+			if len(soldTo[i]) == 0 || soldTo[i][len(soldTo[i])-1] != buyerID {
+				soldTo[i] = append(soldTo[i], buyerID)
+			}
+			if buyer.Demand > 0 {
+				for k, demand := range buyer.ExtraDemand {
+					if demand <= 0 || !extraLimited(supplier, k) {
+						continue
+					}
+					if extraSold[i] == nil {
+						extraSold[i] = make([]int64, len(supplier.ExtraCap))
+					}
+					extraSold[i][k] += mulDiv(record.Amount, demand, buyer.Demand, true)
+				}
+			}
+		}
+
+		limit := domainCap(buyer)
+		for _, domain := range domains {
+			if domainSold[domain] > limit {
+				vs = append(vs, Violation{Kind: ViolationOverDomain, BuyerID: buyerID, Domain: domain,
+					Amount: domainSold[domain], Limit: limit})
+			}
+		}
+	}
+
+	for i := range suppliers {
+		supplier := &suppliers[i]
+		if sold[i] > supplier.Cap {
+			vs = append(vs, Violation{Kind: ViolationOverAllocated, SupplierID: supplier.ID,
+				Amount: sold[i], Limit: supplier.Cap})
+		}
+		for k, amount := range extraSold[i] {
+			if amount > supplier.ExtraCap[k] {
+				vs = append(vs, Violation{Kind: ViolationOverExtraCap, SupplierID: supplier.ID,
+					Amount: amount, Limit: supplier.ExtraCap[k]})
+			}
+		}
+		if supplier.MaxBuyers > 0 && len(soldTo[i]) > supplier.MaxBuyers {
+			for _, buyerID := range soldTo[i][supplier.MaxBuyers:] {
+				vs = append(vs, Violation{Kind: ViolationOverBuyers, BuyerID: buyerID, SupplierID: supplier.ID,
+					Amount: int64(len(soldTo[i])), Limit: int64(supplier.MaxBuyers)})
+			}
+		}
+		if exclusive && len(soldTo[i]) > 1 {
+			for _, buyerID := range soldTo[i][1:] {
+				vs = append(vs, Violation{Kind: ViolationShared, BuyerID: buyerID, SupplierID: supplier.ID,
+					Amount: sold[i]})
+			}
+		}
+	}
+
+	return vs
+}
+
+func sumRecords(records []BuyRecord) int64 {
+	total := int64(0)
+	for _, record := range records {
+		total += record.Amount
+	}
+	return total
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 someonegg. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rsdmatch
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// 1. 各类违规检测
+func TestVerify_Violations(t *testing.T) {
+	suppliers := []Supplier{
+		makeExtraSupplier("s1", 100, 30),
+		makeSupplier("s2", 50, 1, nil),
+	}
+	buyers := []Buyer{
+		makeExtraBuyer("b1", 100, 100),
+		makeBuyer("b2", 100, nil),
+	}
+	affinity := newMockAffinityTable()
+	affinity.setLimit("s2", "b2", 10)
+
+	matches := Matches{
+		"b1": {{"s1", 40}, {"s1", 40}, {"s3", 10}, {"s2", 0}},
+		"b2": {{"s1", 30}, {"s2", 20}},
+		"b3": {{"s1", 5}},
+	}
+
+	vs := Verify(suppliers, buyers, affinity, matches, true)
+
+	expected := []Violation{
+		{Kind: ViolationDuplicate, BuyerID: "b1", SupplierID: "s1", Amount: 40},
+		{Kind: ViolationUnknownSupplier, BuyerID: "b1", SupplierID: "s3", Amount: 10},
+		{Kind: ViolationNonPositive, BuyerID: "b1", SupplierID: "s2", Amount: 0},
+		{Kind: ViolationOverLimit, BuyerID: "b2", SupplierID: "s2", Amount: 20, Limit: 10},
+		{Kind: ViolationUnknownBuyer, BuyerID: "b3", Amount: 5},
+		{Kind: ViolationOverAllocated, SupplierID: "s1", Amount: 110, Limit: 100},
+		{Kind: ViolationOverExtraCap, SupplierID: "s1", Amount: 80, Limit: 30},
+		{Kind: ViolationShared, BuyerID: "b2", SupplierID: "s1", Amount: 110},
+	}
+	if len(vs) != len(expected) {
+		t.Fatalf("Expected %d violations, got %d: %v", len(expected), len(vs), vs)
+	}
+	for i := range expected {
+		if vs[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], vs[i])
+		}
+	}
+
+	if err := error(vs); !strings.HasPrefix(err.Error(), "8 violations: duplicate") {
+		t.Errorf("Unexpected error %q", err.Error())
+	}
+	if vs := Verify(suppliers, buyers, affinity, matches, false); len(vs) != len(expected)-1 {
+		t.Errorf("Expected no shared violation in non-exclusive mode, got %v", vs)
+	}
+}
+
+// 2. 所有匹配器的结果都通过验证
+func TestVerify_Matchers(t *testing.T) {
+	matchers := map[string]struct {
+		m         Matcher
+		exclusive bool
+	}{
+		"Greedy":          {GreedyMatcher(10.0, 10.0, 2, false, false), false},
+		"GreedyExclusive": {GreedyMatcher(10.0, 10.0, 2, true, false), true},
+		"MinCost":         {MinCostMatcher(false), false},
+		"Exclusive":       {ExclusiveMatcher(false), true},
+		"Fair":            {FairMatcher(GreedyMatcher(10.0, 10.0, 2, false, false), MaxMinFair), false},
+	}
+
+	for name, tt := range matchers {
+		t.Run(name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				suppliers, buyers, affinity := randomCase(rand.New(rand.NewSource(seed)))
+				matches, _ := tt.m.Match(suppliers, buyers, affinity)
+				if vs := Verify(suppliers, buyers, affinity, matches, tt.exclusive); vs != nil {
+					t.Fatalf("seed %d: %v", seed, vs)
+				}
+			}
+		})
+	}
+}